@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/gabrielsilvao/challenge1-app/pkg/env"
+	"github.com/gabrielsilvao/challenge1-app/pkg/health"
 	"github.com/gabrielsilvao/challenge1-app/pkg/middleware"
 	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
 	"go.opentelemetry.io/otel/attribute"
@@ -20,6 +31,17 @@ import (
 var (
 	templates *template.Template
 	tel       *telemetry.Telemetry
+	readiness *health.Registry
+
+	// readinessRetryAfter is sent as Retry-After on 503 readiness responses
+	readinessRetryAfter = 5 * time.Second
+
+	// draining is set when graceful shutdown starts; new requests are then
+	// rejected and readiness reports not ready
+	draining atomic.Bool
+
+	// echoRequireMessage rejects echo posts with no "message" field with 422
+	echoRequireMessage bool
 )
 
 func init() {
@@ -31,13 +53,14 @@ func main() {
 	defer cancel()
 
 	// Initialize telemetry
-	cfg := telemetry.NewConfig()
-	var err error
-	tel, err = telemetry.Initialize(ctx, cfg)
+	cfg, err := telemetry.NewConfig()
+	if err == nil {
+		tel, err = telemetry.New(ctx, telemetry.WithConfig(cfg))
+	}
 	if err != nil {
 		log.Printf("Warning: Failed to initialize telemetry: %v (continuing without telemetry)", err)
 	} else {
-		log.Printf("Telemetry initialized - Service: %s, Endpoint: %s", cfg.ServiceName, cfg.OTLPEndpoint)
+		log.Printf("Telemetry initialized - Service: %s, Endpoint: %s, Protocol: %s, Insecure: %t", cfg.ServiceName, cfg.OTLPEndpoint, cfg.Protocol, cfg.Insecure)
 		defer func() {
 			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer shutdownCancel()
@@ -45,71 +68,213 @@ func main() {
 				log.Printf("Error shutting down telemetry: %v", err)
 			}
 		}()
+
+		if cfg.CanaryEnabled {
+			log.Printf("Telemetry canary enabled - Interval: %s", cfg.CanaryInterval)
+			stopCanary := tel.StartCanary(cfg.CanaryInterval)
+			defer stopCanary()
+		}
+	}
+
+	templateTimeout = getEnvDuration("TEMPLATE_TIMEOUT", templateTimeout)
+	readinessRetryAfter = getEnvDuration("READINESS_RETRY_AFTER", readinessRetryAfter)
+	echoRequireMessage = os.Getenv("ECHO_REQUIRE_MESSAGE") == "true"
+	for _, reason := range []string{middleware.ReasonOverloaded, middleware.ReasonMaintenance, middleware.ReasonShuttingDown} {
+		// e.g. RETRY_AFTER_SHUTTING_DOWN; the rate limiter computes its own
+		middleware.SetRetryAfter(reason, getEnvDuration("RETRY_AFTER_"+strings.ToUpper(reason), 0))
+	}
+	// Client IPs (for rate limiting and dedup) come from X-Forwarded-For
+	// only on connections from these proxies, e.g. the load balancer subnet
+	if err := middleware.SetTrustedProxies(getEnvList("TRUSTED_PROXIES", "")); err != nil {
+		log.Fatalf("Error: invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Register readiness checks
+	readiness = health.NewRegistry(getEnvDuration("READINESS_CHECK_TIMEOUT", 2*time.Second))
+	templateErr := validateTemplates()
+	if templateErr != nil {
+		log.Printf("Error: template validation failed: %v (readiness will report not ready)", templateErr)
+	}
+	readiness.Register("templates", func(ctx context.Context) error {
+		if templates == nil {
+			return errors.New("templates not loaded")
+		}
+		return templateErr
+	})
+	readiness.Register("shutdown", shutdownCheck)
+	if tel != nil {
+		// Telemetry is non-critical: an unreachable collector is reported
+		// as degraded without taking the pod out of rotation
+		readiness.RegisterOptional("telemetry", tel.HealthCheck)
+	}
+
+	// Route-scoped middleware, applied inside the global chain below
+	var echoMiddleware []middleware.Middleware
+	if rps := getEnvFloat("RATE_LIMIT_RPS", 0); rps > 0 {
+		rateLimit := middleware.RateLimitOptions{
+			RPS:         rps,
+			Burst:       int(getEnvFloat("RATE_LIMIT_BURST", math.Max(1, math.Ceil(rps)))),
+			WarmUp:      getEnvDuration("RATE_LIMIT_WARMUP", 0),
+			WarmUpStart: math.Min(1, getEnvFloat("RATE_LIMIT_WARMUP_START", 0.1)),
+		}
+		log.Printf("Rate limiting enabled on /echo - RPS: %g, Burst: %d, Warm-up: %s", rateLimit.RPS, rateLimit.Burst, rateLimit.WarmUp)
+		echoMiddleware = append(echoMiddleware, func(next http.Handler) http.Handler {
+			return middleware.RateLimitMiddleware(tel, rateLimit, next)
+		})
+	}
+	maxBodyBytes := getEnvInt64("MAX_REQUEST_BODY_BYTES", 1<<20)
+	echoMiddleware = append(echoMiddleware, func(next http.Handler) http.Handler {
+		return middleware.MaxBodyMiddleware(tel, maxBodyBytes, next)
+	})
+	if tel != nil {
+		dedupWindow := getEnvDuration("DEDUP_WINDOW", 5*time.Second)
+		echoMiddleware = append(echoMiddleware, func(next http.Handler) http.Handler {
+			return middleware.DedupMiddleware(tel, dedupWindow, next)
+		})
+	}
+	if rate := getEnvFloat("API_BODY_SAMPLE_RATE", 0); rate > 0 && tel != nil {
+		bodySample := middleware.BodySampleOptions{
+			Rate:           rate,
+			MaxBytes:       int(getEnvInt64("API_BODY_MAX_BYTES", 1024)),
+			SensitivePaths: getEnvList("API_BODY_SENSITIVE_PATHS", ""),
+		}
+		log.Printf("Body sampling enabled on /echo - Rate: %g, Max bytes: %d, Sensitive paths: %v", bodySample.Rate, bodySample.MaxBytes, bodySample.SensitivePaths)
+		echoMiddleware = append(echoMiddleware, func(next http.Handler) http.Handler {
+			return middleware.BodySampleMiddleware(tel, bodySample, next)
+		})
 	}
 
 	// Create router
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", homeHandler)
-	mux.HandleFunc("/echo", echoHandler)
+	mux.Handle("/echo", middleware.Chain(http.HandlerFunc(echoHandler), echoMiddleware...))
 	mux.HandleFunc("/health", healthHandler)
 	mux.HandleFunc("/ready", readinessHandler)
+	if os.Getenv("DEBUG_ENDPOINTS") == "true" {
+		log.Printf("Debug endpoints enabled - /debug/status/{code}")
+		mux.HandleFunc("/debug/status/", debugStatusHandler)
+	}
+	if tel != nil && tel.MetricsHandler() != nil {
+		mux.Handle("/metrics", tel.MetricsHandler())
+	}
 
-	// Apply middleware
+	// Apply global middleware
 	var handler http.Handler = mux
+	if allowedHosts := getEnvList("ALLOWED_HOSTS", ""); len(allowedHosts) > 0 {
+		exemptPaths := getEnvList("ALLOWED_HOSTS_EXEMPT_PATHS", "/health,/ready")
+		log.Printf("Host validation enabled - Allowed: %v, Exempt paths: %v", allowedHosts, exemptPaths)
+		handler = middleware.HostValidationMiddleware(tel, allowedHosts, exemptPaths, handler)
+	}
+	if origins := getEnvList("CORS_ALLOWED_ORIGINS", ""); len(origins) > 0 {
+		cors := middleware.CORSOptions{
+			AllowedOrigins: origins,
+			AllowedMethods: getEnvList("CORS_ALLOWED_METHODS", "GET,POST"),
+			AllowedHeaders: getEnvList("CORS_ALLOWED_HEADERS", "Content-Type,X-Request-ID"),
+			MaxAge:         getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+		}
+		log.Printf("CORS enabled - Origins: %v, Methods: %v", cors.AllowedOrigins, cors.AllowedMethods)
+		handler = middleware.CORSMiddleware(cors, handler)
+	}
+	if os.Getenv("COMPRESSION_ENABLED") != "false" {
+		handler = middleware.CompressionMiddleware(handler)
+	}
+	handler = middleware.RecoveryMiddleware(tel, handler)
+	handler = middleware.DrainMiddleware(tel, &draining, getEnvList("DRAIN_EXEMPT_PATHS", "/health,/ready"), handler)
+	handler = middleware.RequestIDMiddleware(handler)
 	if tel != nil {
-		handler = middleware.TracingMiddleware(tel, mux)
+		handler = middleware.TracingMiddlewareWithOptions(tel, handler,
+			middleware.WithRouteResolver(middleware.MuxRouteResolver(mux, nil)),
+			middleware.WithSkipPaths(getEnvList("TRACING_SKIP_PATHS", "/health,/ready")...),
+			middleware.WithExcludedAttributes(getEnvList("TRACING_EXCLUDED_ATTRIBUTES", "")...),
+			middleware.WithRequestHeaders(getEnvList("TRACING_REQUEST_HEADERS", "")...),
+			middleware.WithResponseHeaders(getEnvList("TRACING_RESPONSE_HEADERS", "")...),
+			middleware.WithBaggageKeys(getEnvList("TRACING_BAGGAGE_KEYS", "")...),
+		)
 	}
+	handler = middleware.RequestCountMiddleware(handler)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	server := &http.Server{
-		Addr:         ":" + port,
-		Handler:      handler,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	server, err := newServer(":"+port, handler)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
 	// Graceful shutdown
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		sig := <-sigChan
+		shutdownStart := time.Now()
+		inFlightAtSignal := middleware.InFlightRequests()
 		log.Printf("Received signal %v, initiating graceful shutdown...", sig)
 
+		// Reject new requests and fail readiness first; the optional delay
+		// gives the load balancer time to notice before the listener closes
+		draining.Store(true)
+		if delay := getEnvDuration("SHUTDOWN_DRAIN_DELAY", 0); delay > 0 {
+			log.Printf("Draining for %s before shutting down the server", delay)
+			time.Sleep(delay)
+		}
+
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer shutdownCancel()
 
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			log.Printf("Error during server shutdown: %v", err)
 		}
+
+		// Flush what the drained requests recorded before the deferred
+		// telemetry shutdown closes the exporters
+		if tel != nil {
+			if err := tel.ForceFlush(shutdownCtx); err != nil {
+				log.Printf("Error flushing telemetry: %v", err)
+			}
+		}
+
+		// Logged rather than recorded as a metric since the meter provider is
+		// shut down right after this
+		log.Printf(`{"timestamp":"%s","level":"info","service":"sample-web-app","event":"shutdown","shutdown.duration_ms":%.2f,"shutdown.requests_drained":%d,"shutdown.requests_abandoned":%d}`,
+			time.Now().UTC().Format(time.RFC3339),
+			float64(time.Since(shutdownStart).Microseconds())/1000.0,
+			inFlightAtSignal-middleware.InFlightRequests(),
+			middleware.InFlightRequests(),
+		)
 		cancel()
 	}()
 
-	log.Printf("Server starting on port %s", port)
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+	certFile, keyFile, err := tlsFilesFromEnv()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
+
+	if certFile != "" {
+		log.Printf("Server starting on port %s (TLS)", port)
+	} else {
+		log.Printf("Server starting on port %s", port)
+	}
+	err = serve(server, ln, certFile, keyFile)
+	if err != http.ErrServerClosed {
+		log.Fatalf("Server error: %v", err)
+	}
+	// ListenAndServe returns as soon as Shutdown starts; wait for in-flight
+	// requests to drain before tearing down telemetry
+	<-shutdownDone
 	log.Println("Server stopped gracefully")
 }
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Create child span for template rendering
-	if tel != nil {
-		var span trace.Span
-		ctx, span = tel.Tracer.Start(ctx, "render-home-template",
-			trace.WithAttributes(
-				attribute.String("template.name", "index.html"),
-			),
-		)
-		defer span.End()
-	}
-
 	if r.URL.Path != "/" {
 		if tel != nil {
 			span := trace.SpanFromContext(ctx)
@@ -120,13 +285,18 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := templates.ExecuteTemplate(w, "index.html", nil); err != nil {
-		if tel != nil {
-			span := trace.SpanFromContext(ctx)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "template execution failed")
-		}
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	data := homeData{
+		RequestsServed: middleware.RequestsServed(),
+	}
+
+	// Render inside a child span
+	err := tel.Span(ctx, "render-home-template", func(ctx context.Context) error {
+		return renderTemplate(ctx, w, r, "index.html", data)
+	}, trace.WithAttributes(
+		attribute.String("template.name", "index.html"),
+	))
+	if err != nil {
+		writeRenderError(ctx, w, "index.html", err)
 		return
 	}
 }
@@ -146,20 +316,33 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse form with tracing
-	if tel != nil {
-		_, parseSpan := tel.Tracer.Start(ctx, "parse-form")
-		if err := r.ParseForm(); err != nil {
-			parseSpan.RecordError(err)
-			parseSpan.SetStatus(codes.Error, "form parse failed")
-			parseSpan.End()
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+	// Parse the body with tracing; JSON and form-encoded bodies are accepted
+	message, fieldPresent, err := readEchoMessage(ctx, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			middleware.WriteBodyTooLarge(tel, w, r, err)
 			return
 		}
-		parseSpan.End()
+		middleware.LoggerFromContext(ctx).WarnContext(ctx, "echo body parse failed", "error", err.Error())
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Distinguish an absent field from a present-but-empty one
+	if tel != nil {
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.Bool("echo.field_present", fieldPresent))
+	}
+	if !fieldPresent && echoRequireMessage {
+		if tel != nil {
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attribute.String("error.type", "missing_field"))
+		}
+		http.Error(w, "Unprocessable Entity: missing message field", http.StatusUnprocessableEntity)
+		return
 	}
 
-	message := r.FormValue("message")
 	messageLen := len(message)
 
 	// Record span attributes
@@ -174,62 +357,132 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 		tel.RecordMessageLength(ctx, messageLen)
 	}
 
-	// Create child span for template rendering
-	if tel != nil {
-		var renderSpan trace.Span
-		ctx, renderSpan = tel.Tracer.Start(ctx, "render-echo-template",
-			trace.WithAttributes(
-				attribute.String("template.name", "echo.html"),
-				attribute.Int("data.message_length", messageLen),
-			),
-		)
-		defer renderSpan.End()
+	if middleware.WantsJSON(r) {
+		if tel != nil {
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attribute.String("echo.response_format", "json"))
+		}
+		body, _ := json.Marshal(struct {
+			Message string `json:"message"`
+			Length  int    `json:"length"`
+		}{
+			Message: message,
+			Length:  messageLen,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		writeBody(w, r, http.StatusOK, body)
+		return
 	}
 
-	data := struct {
-		Message string
-	}{
+	data := echoData{
 		Message: message,
 	}
 
-	if err := templates.ExecuteTemplate(w, "echo.html", data); err != nil {
+	templateName := selectEchoTemplate(r)
+	if tel != nil {
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("echo.template", templateName))
+	}
+
+	// Render inside a child span
+	err = tel.Span(ctx, "render-echo-template", func(ctx context.Context) error {
+		return renderTemplate(ctx, w, r, templateName, data)
+	}, trace.WithAttributes(
+		attribute.String("template.name", templateName),
+		attribute.Int("data.message_length", messageLen),
+	))
+	if err != nil {
+		writeRenderError(ctx, w, templateName, err)
+		return
+	}
+}
+
+// readEchoMessage extracts the message from a JSON body when the request is
+// sent as application/json, and from the form otherwise, reporting whether
+// the field was present at all
+func readEchoMessage(ctx context.Context, r *http.Request) (string, bool, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var req struct {
+			Message *string `json:"message"`
+		}
+		err := tel.Span(ctx, "parse-json", func(ctx context.Context) error {
+			return json.NewDecoder(r.Body).Decode(&req)
+		})
+		if err != nil || req.Message == nil {
+			return "", false, err
+		}
+		return *req.Message, true, nil
+	}
+
+	err := tel.Span(ctx, "parse-form", func(ctx context.Context) error {
+		return r.ParseForm()
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return r.FormValue("message"), r.Form.Has("message"), nil
+}
+
+func debugStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Synthetic status endpoint for validating alerting and dashboards,
+	// e.g. /debug/status/503 responds with 503
+	ctx := r.Context()
+
+	code, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/debug/status/"))
+	if err != nil || code < 200 || code > 599 || http.StatusText(code) == "" {
 		if tel != nil {
 			span := trace.SpanFromContext(ctx)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "template execution failed")
+			span.SetAttributes(attribute.String("error.type", "invalid_status_code"))
 		}
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		http.Error(w, "Bad Request: invalid status code", http.StatusBadRequest)
 		return
 	}
+
+	if tel != nil {
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.Int("debug.requested_status", code))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeBody(w, r, code, []byte(fmt.Sprintf(`{"status":%d,"text":%q}`, code, http.StatusText(code))))
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	// Health check - minimal processing, no tracing overhead
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"healthy","service":"sample-web-app"}`))
+	writeBody(w, r, http.StatusOK, []byte(`{"status":"healthy","service":"sample-web-app"}`))
+}
+
+// shutdownCheck fails readiness once graceful shutdown has started, so the
+// load balancer stops routing to the draining instance
+func shutdownCheck(ctx context.Context) error {
+	if draining.Load() {
+		return errors.New("server is shutting down")
+	}
+	return nil
 }
 
 func readinessHandler(w http.ResponseWriter, r *http.Request) {
-	// Readiness check - can add dependency checks here
+	// Readiness check - runs registered dependency checks concurrently
 	ctx := r.Context()
 
-	ready := true
-	checks := map[string]string{
-		"templates": "ok",
-	}
+	ready, results := readiness.Run(ctx)
 
-	// Check if templates are loaded
-	if templates == nil {
-		ready = false
-		checks["templates"] = "not loaded"
+	type checkResult struct {
+		Status     string  `json:"status"`
+		DurationMs float64 `json:"duration_ms"`
+		Error      string  `json:"error,omitempty"`
 	}
-
-	// Check telemetry (optional)
-	if tel != nil {
-		checks["telemetry"] = "ok"
-	} else {
-		checks["telemetry"] = "disabled"
+	checks := make(map[string]checkResult, len(results))
+	for _, res := range results {
+		cr := checkResult{
+			Status:     res.Status,
+			DurationMs: float64(res.Duration.Microseconds()) / 1000.0,
+		}
+		if res.Err != nil {
+			cr.Error = res.Err.Error()
+		}
+		checks[res.Name] = cr
 	}
 
 	if tel != nil {
@@ -237,14 +490,87 @@ func readinessHandler(w http.ResponseWriter, r *http.Request) {
 		span.SetAttributes(
 			attribute.Bool("readiness.ready", ready),
 		)
+		for _, res := range results {
+			span.SetAttributes(
+				attribute.String("readiness.check."+res.Name+".status", res.Status),
+				attribute.Float64("readiness.check."+res.Name+".duration_ms", float64(res.Duration.Microseconds())/1000.0),
+			)
+		}
+	}
+
+	status := "ready"
+	statusCode := http.StatusOK
+	if !ready {
+		status = "not ready"
+		statusCode = http.StatusServiceUnavailable
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if ready {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ready","checks":{"templates":"ok"}}`))
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte(`{"status":"not ready","checks":{"templates":"failed"}}`))
+	if !ready {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(readinessRetryAfter.Seconds()))))
+	}
+	body, _ := json.Marshal(struct {
+		Status string                 `json:"status"`
+		Checks map[string]checkResult `json:"checks"`
+	}{
+		Status: status,
+		Checks: checks,
+	})
+	writeBody(w, r, statusCode, body)
+}
+
+// getEnvDuration reads a duration from the environment (see env.Duration),
+// warning and falling back to def when it is invalid
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	d, err := env.Duration(key, def)
+	if err != nil {
+		log.Printf("Warning: %v, using default %s", err, def)
+	}
+	return d
+}
+
+// getEnvInt64 reads a positive integer from the environment, falling back to
+// def on missing or invalid values
+func getEnvInt64(key string, def int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: invalid %s %q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
+
+// getEnvFloat reads a non-negative number from the environment, falling back
+// to def on missing or invalid values
+func getEnvFloat(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		log.Printf("Warning: invalid %s %q, using default %g", key, value, def)
+		return def
+	}
+	return f
+}
+
+// getEnvList reads a comma-separated list from the environment, falling back to def
+func getEnvList(key, def string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		value = def
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
+	return list
 }
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/health"
+	"github.com/gabrielsilvao/challenge1-app/pkg/middleware"
+)
+
+func TestReadEchoMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		wantPresent bool
+		wantErr     bool
+	}{
+		{"json", "application/json", `{"message":"hi"}`, "hi", true, false},
+		{"json with charset", "application/json; charset=utf-8", `{"message":"hi"}`, "hi", true, false},
+		{"json empty message", "application/json", `{"message":""}`, "", true, false},
+		{"json missing field", "application/json", `{}`, "", false, false},
+		{"json malformed", "application/json", `{"message":`, "", false, true},
+		{"form", "application/x-www-form-urlencoded", "message=hi+there", "hi there", true, false},
+		{"form missing field", "application/x-www-form-urlencoded", "other=1", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			got, present, err := readEchoMessage(context.Background(), r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readEchoMessage() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want || present != tt.wantPresent {
+				t.Errorf("readEchoMessage() = %q, %t, want %q, %t", got, present, tt.want, tt.wantPresent)
+			}
+		})
+	}
+}
+
+func TestEchoHandlerJSON(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"message":"hello"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	echoHandler(rec, r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body struct {
+		Message string `json:"message"`
+		Length  int    `json:"length"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Message != "hello" || body.Length != 5 {
+		t.Errorf("body = %+v, want message hello with length 5", body)
+	}
+}
+
+func TestEchoHandlerForm(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("message=<b>hello</b>"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	echoHandler(rec, r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	// The message is rendered escaped by the echo template
+	if body := rec.Body.String(); !strings.Contains(body, "&lt;b&gt;hello&lt;/b&gt;") {
+		t.Errorf("body does not contain the escaped message:\n%s", body)
+	}
+}
+
+func TestEchoHandlerRedirectsGet(t *testing.T) {
+	rec := httptest.NewRecorder()
+	echoHandler(rec, httptest.NewRequest(http.MethodGet, "/echo", nil))
+
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/" {
+		t.Errorf("Location = %q, want /", loc)
+	}
+}
+
+func TestEchoHandlerMalformedJSON(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"message":`))
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	echoHandler(rec, r)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDrainFailsReadiness(t *testing.T) {
+	origReadiness := readiness
+	readiness = health.NewRegistry(time.Second)
+	readiness.Register("shutdown", shutdownCheck)
+	t.Cleanup(func() {
+		readiness = origReadiness
+		draining.Store(false)
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", readinessHandler)
+	mux.HandleFunc("/echo", echoHandler)
+	handler := middleware.DrainMiddleware(nil, &draining, []string{"/health", "/ready"}, mux)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("before draining: /ready status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	draining.Store(true)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("message=hi")))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("draining: /echo status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Connection"); got != "close" {
+		t.Errorf("draining: Connection = %q, want close", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("draining: /ready status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var body struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			Status string `json:"status"`
+		} `json:"checks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode /ready body: %v", err)
+	}
+	if body.Status != "not ready" || body.Checks["shutdown"].Status != health.StatusFailed {
+		t.Errorf("/ready body = %+v, want not ready with the shutdown check failed", body)
+	}
+}
+
+func TestHomeHeadMatchesGet(t *testing.T) {
+	srv := httptest.NewServer(middleware.CompressionMiddleware(http.HandlerFunc(homeHandler)))
+	defer srv.Close()
+	// Keep the transport from negotiating and decoding gzip itself
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	fetch := func(method, acceptEncoding string) (http.Header, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+"/", nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s /: %v", method, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read %s / body: %v", method, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s / status = %d, want %d", method, resp.StatusCode, http.StatusOK)
+		}
+		return resp.Header, body
+	}
+
+	for _, acceptEncoding := range []string{"", "gzip"} {
+		getHeader, getBody := fetch(http.MethodGet, acceptEncoding)
+		headHeader, headBody := fetch(http.MethodHead, acceptEncoding)
+
+		if len(getBody) == 0 {
+			t.Fatalf("Accept-Encoding %q: GET / body is empty", acceptEncoding)
+		}
+		if len(headBody) != 0 {
+			t.Errorf("Accept-Encoding %q: HEAD / body = %d bytes, want none", acceptEncoding, len(headBody))
+		}
+		for _, name := range []string{"Content-Type", "Content-Encoding", "Vary"} {
+			if got, want := headHeader.Get(name), getHeader.Get(name); got != want {
+				t.Errorf("Accept-Encoding %q: HEAD %s = %q, GET sent %q", acceptEncoding, name, got, want)
+			}
+		}
+		// The compressed length is only known once the body is compressed,
+		// so a compressed HEAD response omits it
+		if cl := headHeader.Get("Content-Length"); cl != "" && cl != getHeader.Get("Content-Length") {
+			t.Errorf("Accept-Encoding %q: HEAD Content-Length = %s, GET sent %q", acceptEncoding, cl, getHeader.Get("Content-Length"))
+		}
+	}
+}
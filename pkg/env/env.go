@@ -0,0 +1,44 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration reads a duration from the environment as a Go duration string
+// (e.g. "5s", "1m30s"). OTEL_* variables also accept a bare integer as
+// milliseconds, per the OpenTelemetry convention; elsewhere a bare number
+// is rejected rather than guessed at. Empty or zero selects def. Anything
+// unparseable or negative returns def with an error, so callers choose
+// whether to warn or refuse to start.
+func Duration(key string, def time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := parseDuration(key, value)
+	if err != nil {
+		return def, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	if d < 0 {
+		return def, fmt.Errorf("invalid %s %q: must not be negative", key, value)
+	}
+	if d == 0 {
+		return def, nil
+	}
+	return d, nil
+}
+
+// parseDuration parses value for key, applying the OTel milliseconds form
+func parseDuration(key, value string) (time.Duration, error) {
+	if strings.HasPrefix(key, "OTEL_") {
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Duration(ms) * time.Millisecond, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,40 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	const def = 42 * time.Second
+
+	tests := []struct {
+		key     string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"SERVER_READ_TIMEOUT", "", def, false},
+		{"SERVER_READ_TIMEOUT", "5s", 5 * time.Second, false},
+		{"SERVER_READ_TIMEOUT", " 1m30s ", 90 * time.Second, false},
+		{"SERVER_READ_TIMEOUT", "0", def, false},
+		{"SERVER_READ_TIMEOUT", "0s", def, false},
+		{"SERVER_READ_TIMEOUT", "-1s", def, true},
+		{"SERVER_READ_TIMEOUT", "soon", def, true},
+		// Bare numbers are only milliseconds for OTEL_* variables
+		{"CANARY_INTERVAL", "60", def, true},
+		{"CANARY_INTERVAL", "60s", time.Minute, false},
+		{"OTEL_BSP_SCHEDULE_DELAY", "5000", 5 * time.Second, false},
+		{"OTEL_BSP_SCHEDULE_DELAY", "2s", 2 * time.Second, false},
+		{"OTEL_BSP_SCHEDULE_DELAY", "0", def, false},
+		{"OTEL_BSP_SCHEDULE_DELAY", "-5000", def, true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(tt.key, tt.value)
+		got, err := Duration(tt.key, def)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Duration(%s=%q) = %s, %v; want %s, error %t", tt.key, tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
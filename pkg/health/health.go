@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Check statuses reported for each readiness check
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusTimeout = "timeout"
+	// StatusDegraded replaces failed or timeout for optional checks, which
+	// do not affect overall readiness
+	StatusDegraded = "degraded"
+)
+
+// CheckFunc verifies a single dependency, returning an error if it is unhealthy
+type CheckFunc func(ctx context.Context) error
+
+// Result holds the outcome of a single check
+type Result struct {
+	Name     string
+	Status   string
+	Duration time.Duration
+	Err      error
+}
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	optional bool
+}
+
+// Registry holds the registered readiness checks and runs them concurrently
+type Registry struct {
+	mu      sync.RWMutex
+	checks  []check
+	timeout time.Duration
+}
+
+// NewRegistry creates a registry that bounds each check by the given timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a named check to the registry
+func (r *Registry) Register(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check{name: name, fn: fn})
+}
+
+// RegisterOptional adds a named check for a non-critical dependency. A failing
+// optional check is reported as degraded but does not make Run return false.
+func (r *Registry) RegisterOptional(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check{name: name, fn: fn, optional: true})
+}
+
+// Run executes all checks concurrently and returns once every check has
+// completed or hit its timeout. A check that ignores its context is abandoned
+// and marked as timed out, so Run never waits longer than the timeout.
+func (r *Registry) Run(ctx context.Context) (bool, []Result) {
+	r.mu.RLock()
+	checks := make([]check, len(r.checks))
+	copy(checks, r.checks)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			res := r.runCheck(ctx, c)
+			if c.optional && res.Status != StatusOK {
+				res.Status = StatusDegraded
+			}
+			results[i] = res
+		}(i, c)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, res := range results {
+		if res.Status != StatusOK && res.Status != StatusDegraded {
+			ready = false
+		}
+	}
+
+	return ready, results
+}
+
+// runCheck runs a single check bounded by the registry timeout
+func (r *Registry) runCheck(ctx context.Context, c check) Result {
+	checkCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("check panicked: %v", rec)
+			}
+		}()
+		done <- c.fn(checkCtx)
+	}()
+
+	select {
+	case err := <-done:
+		res := Result{Name: c.name, Status: StatusOK, Duration: time.Since(start), Err: err}
+		if err != nil {
+			res.Status = StatusFailed
+		}
+		return res
+	case <-checkCtx.Done():
+		return Result{
+			Name:     c.name,
+			Status:   StatusTimeout,
+			Duration: time.Since(start),
+			Err:      checkCtx.Err(),
+		}
+	}
+}
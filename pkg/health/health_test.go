@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// statuses maps check names to their reported status
+func statuses(results []Result) map[string]string {
+	m := make(map[string]string, len(results))
+	for _, res := range results {
+		m[res.Name] = res.Status
+	}
+	return m
+}
+
+func TestRunAllOK(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("a", func(ctx context.Context) error { return nil })
+	r.Register("b", func(ctx context.Context) error { return nil })
+
+	ready, results := r.Run(context.Background())
+	if !ready {
+		t.Error("ready = false, want true")
+	}
+	if got := statuses(results); got["a"] != StatusOK || got["b"] != StatusOK {
+		t.Errorf("statuses = %v, want both ok", got)
+	}
+}
+
+func TestRunCheckIgnoringContextTimesOut(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	r := NewRegistry(timeout)
+	block := make(chan struct{})
+	defer close(block)
+	r.Register("stuck", func(ctx context.Context) error {
+		<-block // ignores ctx
+		return nil
+	})
+	r.Register("fast", func(ctx context.Context) error { return nil })
+
+	start := time.Now()
+	ready, results := r.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > timeout+100*time.Millisecond {
+		t.Errorf("Run took %s, want about %s", elapsed, timeout)
+	}
+
+	if ready {
+		t.Error("ready = true, want false")
+	}
+	got := statuses(results)
+	if got["stuck"] != StatusTimeout {
+		t.Errorf("stuck = %q, want %q", got["stuck"], StatusTimeout)
+	}
+	if got["fast"] != StatusOK {
+		t.Errorf("fast = %q, want %q", got["fast"], StatusOK)
+	}
+}
+
+func TestRunPanickingCheck(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("boom", func(ctx context.Context) error { panic("boom") })
+
+	ready, results := r.Run(context.Background())
+	if ready {
+		t.Error("ready = true, want false")
+	}
+	if len(results) != 1 || results[0].Status != StatusFailed {
+		t.Fatalf("results = %+v, want one failed check", results)
+	}
+	if results[0].Err == nil {
+		t.Error("panicking check has no error")
+	}
+}
+
+func TestRunOptionalCheckDegraded(t *testing.T) {
+	r := NewRegistry(50 * time.Millisecond)
+	r.Register("db", func(ctx context.Context) error { return nil })
+	r.RegisterOptional("telemetry", func(ctx context.Context) error { return errors.New("collector unreachable") })
+	r.RegisterOptional("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ready, results := r.Run(context.Background())
+	if !ready {
+		t.Error("ready = false, want true with only optional checks failing")
+	}
+	got := statuses(results)
+	for _, name := range []string{"telemetry", "slow"} {
+		if got[name] != StatusDegraded {
+			t.Errorf("%s = %q, want %q", name, got[name], StatusDegraded)
+		}
+	}
+	if got["db"] != StatusOK {
+		t.Errorf("db = %q, want %q", got["db"], StatusOK)
+	}
+}
+
+func TestRunFailingCheck(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("db", func(ctx context.Context) error { return errors.New("down") })
+
+	ready, results := r.Run(context.Background())
+	if ready {
+		t.Error("ready = true, want false")
+	}
+	if got := statuses(results)["db"]; got != StatusFailed {
+		t.Errorf("db = %q, want %q", got, StatusFailed)
+	}
+}
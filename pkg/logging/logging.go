@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// loggerKey is the context key for the request-scoped logger
+type loggerKey struct{}
+
+// defaultLogger is returned by FromContext when no logger was attached
+var defaultLogger = New(os.Stderr, "sample-web-app")
+
+// New returns a JSON logger writing to w that tags every record with service
+// and, for records logged with a context, the trace_id and span_id of the
+// active span
+func New(w io.Writer, service string) *slog.Logger {
+	return slog.New(NewHandler(slog.NewJSONHandler(w, nil))).With("service", service)
+}
+
+// Default returns the process-wide JSON logger
+func Default() *slog.Logger {
+	return defaultLogger
+}
+
+// WithContext returns a copy of ctx carrying logger
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger attached with WithContext, falling back to
+// the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return defaultLogger
+}
+
+// Handler is a slog.Handler that adds trace_id and span_id from the span in
+// the record's context before delegating to the wrapped handler. Records
+// logged without a context (Info rather than InfoContext) or outside a span
+// are passed through unchanged.
+type Handler struct {
+	next slog.Handler
+}
+
+// NewHandler wraps next with trace correlation
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{next: next}
+}
+
+// Enabled reports whether the wrapped handler handles records at level
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the trace correlation fields and forwards the record
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			r = r.Clone()
+			r.AddAttrs(
+				slog.String("trace_id", sc.TraceID().String()),
+				slog.String("span_id", sc.SpanID().String()),
+			)
+		}
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a Handler whose wrapped handler has attrs added
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup returns a Handler whose wrapped handler opens group
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// decode parses the single JSON record in buf
+func decode(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", buf.String(), err)
+	}
+	return record
+}
+
+func TestHandlerAddsTraceCorrelation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "test")
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	logger.InfoContext(ctx, "inside span")
+
+	record := decode(t, &buf)
+	sc := span.SpanContext()
+	if got := record["trace_id"]; got != sc.TraceID().String() {
+		t.Errorf("trace_id = %v, want %s", got, sc.TraceID())
+	}
+	if got := record["span_id"]; got != sc.SpanID().String() {
+		t.Errorf("span_id = %v, want %s", got, sc.SpanID())
+	}
+	if got := record["service"]; got != "test" {
+		t.Errorf("service = %v, want test", got)
+	}
+}
+
+func TestHandlerWithoutSpan(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, "test").InfoContext(context.Background(), "no span")
+
+	record := decode(t, &buf)
+	if _, ok := record["trace_id"]; ok {
+		t.Errorf("trace_id = %v outside a span, want none", record["trace_id"])
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != Default() {
+		t.Error("FromContext() without a logger is not the default logger")
+	}
+
+	logger := New(&bytes.Buffer{}, "test")
+	if FromContext(WithContext(context.Background(), logger)) != logger {
+		t.Error("FromContext() did not return the attached logger")
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Backpressure reasons reported to clients and recorded in backpressure_total
+const (
+	ReasonRateLimited  = "rate_limited"
+	ReasonOverloaded   = "overloaded"
+	ReasonMaintenance  = "maintenance"
+	ReasonShuttingDown = "shutting_down"
+)
+
+// backpressureProblems maps each reason to its status code and client detail
+var backpressureProblems = map[string]struct {
+	status int
+	detail string
+}{
+	ReasonRateLimited:  {http.StatusTooManyRequests, "Request rate limit exceeded, retry after the indicated delay."},
+	ReasonOverloaded:   {http.StatusServiceUnavailable, "The server is overloaded, retry after the indicated delay."},
+	ReasonMaintenance:  {http.StatusServiceUnavailable, "The server is unavailable for maintenance, retry after the indicated delay."},
+	ReasonShuttingDown: {http.StatusServiceUnavailable, "The server is shutting down, retry on a new connection."},
+}
+
+// retryAfterDefaults holds the Retry-After sent for each reason when the
+// caller has no specific delay of its own
+var (
+	retryAfterMu       sync.RWMutex
+	retryAfterDefaults = make(map[string]time.Duration)
+)
+
+// SetRetryAfter sets the Retry-After sent with reason when WriteBackpressure
+// is called without a delay, as for draining or maintenance. Zero removes
+// it. Call it during startup, before serving.
+func SetRetryAfter(reason string, d time.Duration) {
+	retryAfterMu.Lock()
+	defer retryAfterMu.Unlock()
+
+	if d > 0 {
+		retryAfterDefaults[reason] = d
+	} else {
+		delete(retryAfterDefaults, reason)
+	}
+}
+
+// problem is an RFC 7807 problem details body
+type problem struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Status  int    `json:"status"`
+	Detail  string `json:"detail"`
+	Reason  string `json:"reason,omitempty"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// WriteBackpressure writes the standard backpressure response shared by every
+// load-shedding feature: 429 for rate_limited and 503 otherwise, a
+// Retry-After header and a problem+json body naming the reason. A zero
+// retryAfter falls back to the delay set with SetRetryAfter, and no header
+// is sent if there is none. The rejection is marked on the span and counted
+// in backpressure_total.
+func WriteBackpressure(tel *telemetry.Telemetry, w http.ResponseWriter, r *http.Request, reason string, retryAfter time.Duration) {
+	p, ok := backpressureProblems[reason]
+	if !ok {
+		p = backpressureProblems[ReasonOverloaded]
+	}
+
+	if retryAfter <= 0 {
+		retryAfterMu.RLock()
+		retryAfter = retryAfterDefaults[reason]
+		retryAfterMu.RUnlock()
+	}
+
+	span := trace.SpanFromContext(r.Context())
+	if tel != nil {
+		span.SetStatus(codes.Error, reason)
+		span.SetAttributes(
+			attribute.String("error.type", reason),
+			attribute.Bool("backpressure", true),
+		)
+		tel.RecordBackpressure(r.Context(), reason)
+	}
+
+	body := problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(p.status),
+		Status: p.status,
+		Detail: p.detail,
+		Reason: reason,
+	}
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		body.TraceID = sc.TraceID().String()
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	w.WriteHeader(p.status)
+	json.NewEncoder(w).Encode(body)
+}
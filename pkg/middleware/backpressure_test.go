@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+)
+
+func TestWriteBackpressure(t *testing.T) {
+	SetRetryAfter(ReasonMaintenance, 2*time.Minute)
+	SetRetryAfter(ReasonShuttingDown, 1500*time.Millisecond)
+	t.Cleanup(func() {
+		SetRetryAfter(ReasonMaintenance, 0)
+		SetRetryAfter(ReasonShuttingDown, 0)
+	})
+
+	tests := []struct {
+		reason     string
+		retryAfter time.Duration
+		wantStatus int
+		wantReason string
+		wantHeader string
+	}{
+		{ReasonRateLimited, 300 * time.Millisecond, http.StatusTooManyRequests, ReasonRateLimited, "1"},
+		{ReasonOverloaded, 0, http.StatusServiceUnavailable, ReasonOverloaded, ""},
+		{ReasonOverloaded, 5 * time.Second, http.StatusServiceUnavailable, ReasonOverloaded, "5"},
+		{ReasonMaintenance, 0, http.StatusServiceUnavailable, ReasonMaintenance, "120"},
+		{ReasonShuttingDown, 0, http.StatusServiceUnavailable, ReasonShuttingDown, "2"},
+		{"unknown", 0, http.StatusServiceUnavailable, "unknown", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			tel, _ := telemetry.NewForTesting()
+			rec := httptest.NewRecorder()
+			WriteBackpressure(tel, rec, httptest.NewRequest(http.MethodGet, "/echo", nil), tt.reason, tt.retryAfter)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantHeader {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantHeader)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+
+			var body problem
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Reason != tt.wantReason || body.Status != tt.wantStatus {
+				t.Errorf("body reason/status = %q/%d, want %q/%d", body.Reason, body.Status, tt.wantReason, tt.wantStatus)
+			}
+
+			snap, err := tel.Snapshot(context.Background())
+			if err != nil {
+				t.Fatalf("Snapshot: %v", err)
+			}
+			if got := snap.Values["backpressure_total"]; got != 1 {
+				t.Errorf("backpressure_total = %v, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BodySampleOptions configures BodySampleMiddleware
+type BodySampleOptions struct {
+	// Rate is the fraction of JSON requests whose bodies are captured, from
+	// 0 (never) to 1 (always)
+	Rate float64
+	// MaxBytes caps how much of each body is recorded
+	MaxBytes int
+	// SensitivePaths are never captured, whatever the rate
+	SensitivePaths []string
+}
+
+// secretFieldRe matches JSON members whose name suggests a credential,
+// capturing the name so only the value is redacted. The closing quote is
+// optional so a value cut off by truncation is still redacted.
+var secretFieldRe = regexp.MustCompile(`(?i)("[^"]*(?:password|passwd|secret|token|api[_-]?key|authorization|credential)[^"]*"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+
+// BodySampleMiddleware records the request and response bodies of a sampled
+// fraction of JSON requests on the span as http.request.body and
+// http.response.body, for debugging client integrations. Bodies are
+// truncated to MaxBytes and credential-like JSON members are redacted.
+// Requests to SensitivePaths are never captured. A zero Rate disables it.
+func BodySampleMiddleware(tel *telemetry.Telemetry, opts BodySampleOptions, next http.Handler) http.Handler {
+	if tel == nil || opts.Rate <= 0 || opts.MaxBytes <= 0 {
+		return next
+	}
+
+	sensitive := make(map[string]bool, len(opts.SensitivePaths))
+	for _, p := range opts.SensitivePaths {
+		sensitive[p] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sensitive[r.URL.Path] || !isJSONRequest(r) || rand.Float64() >= opts.Rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqBody := &captureBuffer{max: opts.MaxBytes}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = readCloser{io.TeeReader(r.Body, reqBody), r.Body}
+		}
+		cw := &captureResponseWriter{ResponseWriter: w, body: &captureBuffer{max: opts.MaxBytes}}
+
+		next.ServeHTTP(cw, r)
+
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.Bool("http.body_sampled", true),
+			attribute.String("http.request.body", redactSecrets(reqBody.buf)),
+			attribute.Bool("http.request.body.truncated", reqBody.truncated),
+			attribute.String("http.response.body", redactSecrets(cw.body.buf)),
+			attribute.Bool("http.response.body.truncated", cw.body.truncated),
+		)
+	})
+}
+
+// isJSONRequest reports whether the request carries or asks for JSON
+func isJSONRequest(r *http.Request) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		return true
+	}
+	return WantsJSON(r)
+}
+
+// redactSecrets replaces the values of credential-like JSON members. Invalid
+// UTF-8 is replaced too, since the OTLP exporter rejects the whole batch when
+// a string attribute contains it.
+func redactSecrets(body []byte) string {
+	redacted := secretFieldRe.ReplaceAllString(string(body), `${1}"[REDACTED]"`)
+	return strings.ToValidUTF8(redacted, "\uFFFD")
+}
+
+// captureBuffer keeps the first max bytes written to it, cut on a rune
+// boundary, and notes whether anything was dropped. Writes never fail, so it
+// can tee a live stream.
+type captureBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	if b.truncated {
+		return len(p), nil
+	}
+	if room := b.max - len(b.buf); room < len(p) {
+		// Cut before the rune straddling the limit rather than through it
+		for room > 0 && !utf8.RuneStart(p[room]) {
+			room--
+		}
+		b.buf = append(b.buf, p[:room]...)
+		b.truncated = true
+	} else {
+		b.buf = append(b.buf, p...)
+	}
+	return len(p), nil
+}
+
+// captureResponseWriter copies the response body into a captureBuffer as it
+// is written
+type captureResponseWriter struct {
+	http.ResponseWriter
+	body *captureBuffer
+}
+
+func (cw *captureResponseWriter) Write(b []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(b)
+	cw.body.Write(b[:n])
+	return n, err
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (cw *captureResponseWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (cw *captureResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
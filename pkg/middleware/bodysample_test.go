@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// echoJSON echoes the request body back as JSON
+var echoJSON = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+})
+
+func TestBodySampleMiddleware(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddleware(tel, BodySampleMiddleware(tel, BodySampleOptions{Rate: 1, MaxBytes: 64}, echoJSON))
+
+	body := `{"message":"hi","password":"hunter2","apiKey":"abc123"}`
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := attrs(endedSpan(t, spans).Attributes)
+	want := `{"message":"hi","password":"[REDACTED]","apiKey":"[REDACTED]"}`
+	if v := got["http.request.body"].AsString(); v != want {
+		t.Errorf("http.request.body = %q, want %q", v, want)
+	}
+	if v := got["http.response.body"].AsString(); v != want {
+		t.Errorf("http.response.body = %q, want %q", v, want)
+	}
+	if got["http.request.body.truncated"].AsBool() {
+		t.Error("http.request.body.truncated = true, want false")
+	}
+}
+
+func TestBodySampleMiddlewareTruncates(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddleware(tel, BodySampleMiddleware(tel, BodySampleOptions{Rate: 1, MaxBytes: 24}, echoJSON))
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"message":"x","token":"0123456789abcdef"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := attrs(endedSpan(t, spans).Attributes)
+	if !got["http.request.body.truncated"].AsBool() {
+		t.Error("http.request.body.truncated = false, want true")
+	}
+	// The secret is cut off mid-value and must still be redacted
+	if v := got["http.request.body"].AsString(); strings.Contains(v, "0123") {
+		t.Errorf("http.request.body = %q leaks the token", v)
+	}
+}
+
+func TestBodySampleMiddlewareSkips(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        BodySampleOptions
+		contentType string
+	}{
+		{"rate zero", BodySampleOptions{Rate: 0, MaxBytes: 64}, "application/json"},
+		{"sensitive path", BodySampleOptions{Rate: 1, MaxBytes: 64, SensitivePaths: []string{"/echo"}}, "application/json"},
+		{"form post", BodySampleOptions{Rate: 1, MaxBytes: 64}, "application/x-www-form-urlencoded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, spans := telemetry.NewForTesting()
+			handler := TracingMiddleware(tel, BodySampleMiddleware(tel, tt.opts, echoJSON))
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"message":"hi"}`))
+			req.Header.Set("Content-Type", tt.contentType)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			got := attrs(endedSpan(t, spans).Attributes)
+			for _, key := range []string{"http.body_sampled", "http.request.body", "http.response.body"} {
+				if _, ok := got[attribute.Key(key)]; ok {
+					t.Errorf("%s recorded, want no capture", key)
+				}
+			}
+		})
+	}
+}
+
+func TestBodySampleMiddlewareKeepsValidUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		// "é" is two bytes and straddles the 11-byte limit
+		{"rune at the cut", `{"m":"abcdé"}`, `{"m":"abcd`},
+		{"invalid bytes", "{\"m\":\"\xff\"}", "{\"m\":\"�\"}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, spans := telemetry.NewForTesting()
+			handler := TracingMiddleware(tel, BodySampleMiddleware(tel, BodySampleOptions{Rate: 1, MaxBytes: 11}, echoJSON))
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			got := attrs(endedSpan(t, spans).Attributes)
+			for _, key := range []attribute.Key{"http.request.body", "http.response.body"} {
+				v := got[key].AsString()
+				if !utf8.ValidString(v) {
+					t.Errorf("%s = %q is not valid UTF-8", key, v)
+				}
+				if v != tt.want {
+					t.Errorf("%s = %q, want %q", key, v, tt.want)
+				}
+			}
+		})
+	}
+}
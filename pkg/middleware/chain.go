@@ -0,0 +1,16 @@
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with additional behavior
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with the given middleware so the first one listed runs
+// outermost. It lets each route compose only the middleware it needs instead
+// of wrapping the whole mux.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// trustedProxies are the peers whose X-Forwarded-For header is believed
+var (
+	trustedProxiesMu sync.RWMutex
+	trustedProxies   []netip.Prefix
+)
+
+// SetTrustedProxies sets the CIDRs (or bare IPs) of the proxies in front of
+// the server, e.g. the load balancer's subnet. X-Forwarded-For is only read
+// on connections from them; with none configured the peer address is the
+// client. Call it during startup, before serving.
+func SetTrustedProxies(cidrs []string) error {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			addr, err := netip.ParseAddr(c)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", c, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(c)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", c, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	trustedProxiesMu.Lock()
+	defer trustedProxiesMu.Unlock()
+	trustedProxies = prefixes
+	return nil
+}
+
+// isTrustedProxy reports whether ip belongs to a trusted proxy
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the originating client IP. The peer address is used
+// unless it is a trusted proxy, in which case X-Forwarded-For is walked from
+// the right, past any further trusted proxies, to the first hop they did not
+// add. Entries left of that are client-supplied and could be forged to dodge
+// per-client limits.
+func clientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop != "" && !isTrustedProxy(hop) {
+			return hop
+		}
+	}
+	return peer
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useTrustedProxies sets the trusted proxies for the duration of the test
+func useTrustedProxies(t *testing.T, cidrs ...string) {
+	t.Helper()
+	if err := SetTrustedProxies(cidrs); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"no header", nil, "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"untrusted peer", nil, "192.0.2.1:1234", []string{"203.0.113.7"}, "192.0.2.1"},
+		{"trusted peer", []string{"192.0.2.0/24"}, "192.0.2.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"forged prefix", []string{"192.0.2.0/24"}, "192.0.2.1:1234", []string{"10.0.0.1, 203.0.113.7"}, "203.0.113.7"},
+		{"repeated header", []string{"192.0.2.0/24"}, "192.0.2.1:1234", []string{"10.0.0.1", "203.0.113.7"}, "203.0.113.7"},
+		{"proxy chain", []string{"192.0.2.0/24", "10.1.0.0/16"}, "192.0.2.1:1234", []string{"203.0.113.7, 10.1.2.3"}, "203.0.113.7"},
+		{"bare IP", []string{"192.0.2.1"}, "192.0.2.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"IPv6 peer", []string{"2001:db8::/32"}, "[2001:db8::1]:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"trusted peer without header", []string{"192.0.2.0/24"}, "192.0.2.1:1234", nil, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTrustedProxies(t, tt.trusted...)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxiesInvalid(t *testing.T) {
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+	for _, cidr := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if err := SetTrustedProxies([]string{cidr}); err == nil {
+			t.Errorf("SetTrustedProxies(%q) = nil, want error", cidr)
+		}
+	}
+}
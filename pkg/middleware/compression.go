@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressBytes is the smallest declared Content-Length worth compressing;
+// below it the gzip framing outweighs the savings
+const minCompressBytes = 256
+
+// gzipWriters pools gzip writers, which are expensive to allocate
+var gzipWriters = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// CompressionMiddleware gzips responses for clients that accept it. Responses
+// that are already encoded, have an incompressible content type (images,
+// archives, ...) or declare a tiny Content-Length are passed through
+// unchanged, as are protocol upgrades (e.g. WebSocket), whose connection is
+// hijacked rather than written through. Placed inside TracingMiddleware, the
+// recorded response size is the compressed size actually sent.
+//
+// HEAD requests make the same decision and get the same Content-Encoding as
+// the matching GET, but the body is never compressed; since the compressed
+// length is unknown, a compressed HEAD response carries no Content-Length.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Header.Get("Upgrade") != "" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, head: r.Method == http.MethodHead}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding value allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter compresses the body once the response headers show it
+// is worth compressing. For HEAD it only sets the headers and discards the
+// body, which net/http would otherwise measure as the Content-Length.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	head        bool
+	discard     bool
+	wroteHeader bool
+}
+
+// WriteHeader decides whether to compress before the headers go out
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.Header()
+	if shouldCompress(code, h) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		if g.head {
+			g.discard = true
+		} else {
+			g.gz = gzipWriters.Get().(*gzip.Writer)
+			g.gz.Reset(g.ResponseWriter)
+		}
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+// Write compresses b when compression was selected. The content type is
+// sniffed from the uncompressed bytes, since sniffing after compression
+// would always report application/octet-stream.
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.discard {
+		return len(b), nil
+	}
+	if g.gz == nil {
+		return g.ResponseWriter.Write(b)
+	}
+	return g.gz.Write(b)
+}
+
+// Flush flushes buffered compressed data before flushing the connection
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, returning http.ErrNotSupported when the
+// underlying writer can't be hijacked
+func (g *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := g.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// ReadFrom implements io.ReaderFrom. Uncompressed responses keep the
+// underlying writer's optimized copy (e.g. sendfile); everything else goes
+// through Write so it is sniffed and compressed.
+func (g *gzipResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if g.wroteHeader && g.gz == nil && !g.discard {
+		if rf, ok := g.ResponseWriter.(io.ReaderFrom); ok {
+			return rf.ReadFrom(src)
+		}
+	}
+	// Hide our own ReadFrom from io.Copy to avoid recursing
+	return io.Copy(struct{ io.Writer }{g}, src)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// close writes the gzip trailer and returns the writer to the pool
+func (g *gzipResponseWriter) close() {
+	if g.gz == nil {
+		return
+	}
+	g.gz.Close()
+	g.gz.Reset(io.Discard)
+	gzipWriters.Put(g.gz)
+	g.gz = nil
+}
+
+// shouldCompress reports whether a response with the given status and
+// headers benefits from compression
+func shouldCompress(code int, h http.Header) bool {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < minCompressBytes {
+			return false
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml",
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		mediaType == "application/zip",
+		mediaType == "application/gzip",
+		mediaType == "application/x-gzip",
+		mediaType == "application/zstd",
+		mediaType == "font/woff2":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// page is large enough to be worth compressing
+var page = strings.Repeat("<p>hello</p>", 100)
+
+func TestCompressionMiddlewareGzip(t *testing.T) {
+	handler := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, page)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html sniffed from the uncompressed body", ct)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", vary)
+	}
+	if got := gunzip(t, rec.Body); got != page {
+		t.Errorf("decompressed body = %q, want the page", got)
+	}
+}
+
+func TestCompressionMiddlewarePlaintext(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		contentLength  string
+	}{
+		{"no accept-encoding", "", "text/html", ""},
+		{"gzip refused", "gzip;q=0", "text/html", ""},
+		{"incompressible type", "gzip", "image/png", ""},
+		{"tiny body", "gzip", "text/html", "12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.contentLength != "" {
+					w.Header().Set("Content-Length", tt.contentLength)
+					io.WriteString(w, page[:12])
+					return
+				}
+				io.WriteString(w, page)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+				t.Errorf("Content-Encoding = %q, want none", ce)
+			}
+			if !strings.HasPrefix(page, rec.Body.String()) || rec.Body.Len() == 0 {
+				t.Errorf("body = %q, want the plain page", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareReadFrom(t *testing.T) {
+	handler := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader(page)); err != nil {
+			t.Errorf("ReadFrom: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+	if got := gunzip(t, rec.Body); got != page {
+		t.Errorf("decompressed body = %q, want the page", got)
+	}
+}
+
+// hijackRecorder is a ResponseRecorder whose connection can be hijacked
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	server, client := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+func TestCompressionMiddlewareHijack(t *testing.T) {
+	tests := []struct {
+		name    string
+		upgrade string
+	}{
+		{"upgrade request", "websocket"},
+		{"plain request", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, isGzip := w.(*gzipResponseWriter); isGzip == (tt.upgrade != "") {
+					t.Errorf("wrapped in gzipResponseWriter = %t for Upgrade %q", isGzip, tt.upgrade)
+				}
+				conn, _, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Fatalf("Hijack: %v", err)
+				}
+				conn.Close()
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			if tt.upgrade != "" {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", tt.upgrade)
+			}
+			rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+			handler.ServeHTTP(rec, req)
+
+			if !rec.hijacked {
+				t.Error("underlying connection was not hijacked")
+			}
+		})
+	}
+}
+
+// gunzip decompresses r, failing the test if it isn't valid gzip
+func gunzip(t *testing.T, r io.Reader) string {
+	t.Helper()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip body: %v", err)
+	}
+	return string(body)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures CORSMiddleware
+type CORSOptions struct {
+	// AllowedOrigins lists origins (e.g. "https://app.example.com") allowed
+	// to make cross-origin requests; "*" allows any origin
+	AllowedOrigins []string
+	// AllowedMethods are returned to preflight requests
+	AllowedMethods []string
+	// AllowedHeaders are the request headers preflight requests may ask for
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response; zero omits
+	// the header
+	MaxAge time.Duration
+}
+
+// CORSMiddleware adds CORS headers for requests from allowed origins. Preflight
+// requests (OPTIONS with Access-Control-Request-Method) are answered with a
+// 204 and never reach next; origins not in the allow list get no CORS headers,
+// so the browser blocks the response.
+func CORSMiddleware(opts CORSOptions, next http.Handler) http.Handler {
+	allowAny := false
+	origins := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, o := range opts.AllowedOrigins {
+		o = strings.TrimSpace(o)
+		if o == "*" {
+			allowAny = true
+		}
+		origins[strings.ToLower(o)] = true
+	}
+
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Responses differ by Origin, so shared caches must key on it
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		allowed := allowAny || origins[strings.ToLower(origin)]
+		if allowed {
+			if allowAny {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		if allowed {
+			if methods != "" {
+				h.Set("Access-Control-Allow-Methods", methods)
+			}
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
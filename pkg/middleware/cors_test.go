@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var corsOpts = CORSOptions{
+	AllowedOrigins: []string{"https://app.example.com"},
+	AllowedMethods: []string{"GET", "POST"},
+	AllowedHeaders: []string{"Content-Type"},
+	MaxAge:         10 * time.Minute,
+}
+
+func TestCORSMiddlewareAllowedOrigin(t *testing.T) {
+	handler := CORSMiddleware(corsOpts, ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestCORSMiddlewareDisallowedOrigin(t *testing.T) {
+	handler := CORSMiddleware(corsOpts, ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+	// The request still reaches the handler; the browser blocks the response
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestCORSMiddlewarePreflight(t *testing.T) {
+	reached := false
+	handler := CORSMiddleware(corsOpts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/echo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if reached {
+		t.Error("preflight request reached the handler")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+	for name, v := range want {
+		if got := rec.Header().Get(name); got != v {
+			t.Errorf("%s = %q, want %q", name, got, v)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// requestsServed counts requests handled in-process, since the OTel request
+// counter can't be read back
+var requestsServed atomic.Int64
+
+// RequestsServed returns the number of requests handled so far
+func RequestsServed() int64 {
+	return requestsServed.Load()
+}
+
+// inFlight counts requests currently being handled
+var inFlight atomic.Int64
+
+// InFlightRequests returns the number of requests currently being handled
+func InFlightRequests() int64 {
+	return inFlight.Load()
+}
+
+// RequestCountMiddleware maintains RequestsServed and InFlightRequests. It
+// doesn't depend on telemetry, so the counts stay accurate when telemetry
+// is disabled; install it outermost so every request is counted.
+func RequestCountMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsServed.Add(1)
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
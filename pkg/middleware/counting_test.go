@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestCountMiddleware(t *testing.T) {
+	served := RequestsServed()
+	var inHandler int64
+	handler := RequestCountMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHandler = InFlightRequests()
+	}))
+
+	inFlightBefore := InFlightRequests()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if inHandler != inFlightBefore+1 {
+		t.Errorf("in flight during request = %d, want %d", inHandler, inFlightBefore+1)
+	}
+	if got := InFlightRequests(); got != inFlightBefore {
+		t.Errorf("in flight after request = %d, want %d", got, inFlightBefore)
+	}
+	if got := RequestsServed(); got != served+1 {
+		t.Errorf("RequestsServed() = %d, want %d", got, served+1)
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxDedupBodyBytes caps how much of the body is hashed for the heuristic
+	maxDedupBodyBytes = 64 << 10
+	// maxDedupEntries bounds the dedup state between evictions
+	maxDedupEntries = 10000
+)
+
+// DedupMiddleware flags likely duplicate requests (client retries) seen again
+// within window. Requests are keyed by their Idempotency-Key header when
+// present, otherwise by client IP, method, path and a hash of the body.
+// Duplicates are recorded on the span and in duplicate_requests_total but
+// are still served normally.
+func DedupMiddleware(tel *telemetry.Telemetry, window time.Duration, next http.Handler) http.Handler {
+	seen := &dedupCache{
+		window:  window,
+		entries: make(map[string]time.Time),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, source := dedupKey(r)
+		if key != "" && seen.checkAndStore(key, time.Now()) {
+			span := trace.SpanFromContext(r.Context())
+			span.SetAttributes(
+				attribute.Bool("request.likely_duplicate", true),
+				attribute.String("request.duplicate_source", source),
+			)
+			if tel != nil {
+				tel.RecordDuplicateRequest(r.Context(), r.Method, source)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dedupKey builds the dedup key for a request and reports how it was derived.
+// Safe methods without an Idempotency-Key are not tracked, since repeated
+// page loads are not retries.
+func dedupKey(r *http.Request) (string, string) {
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		return "idem:" + key, "idempotency_key"
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return "", ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(clientIP(r) + "|" + r.Method + "|" + r.URL.Path + "|"))
+
+	if r.Body != nil && r.Body != http.NoBody {
+		// Hash a bounded prefix and restore it so the handler sees the full body
+		prefix, err := io.ReadAll(io.LimitReader(r.Body, maxDedupBodyBytes))
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+		if err != nil {
+			return "", ""
+		}
+		h.Write(prefix)
+	}
+
+	return "req:" + hex.EncodeToString(h.Sum(nil)), "heuristic"
+}
+
+// readCloser pairs a replacement reader with the original body's Close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// dedupCache remembers recently seen keys with TTL eviction
+type dedupCache struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]time.Time
+	lastSweep time.Time
+}
+
+// checkAndStore records key and reports whether it was already seen within
+// the window
+func (c *dedupCache) checkAndStore(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= c.window {
+		for k, t := range c.entries {
+			if now.Sub(t) >= c.window {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if t, ok := c.entries[key]; ok && now.Sub(t) < c.window {
+		c.entries[key] = now
+		return true
+	}
+
+	if len(c.entries) < maxDedupEntries {
+		c.entries[key] = now
+	}
+	return false
+}
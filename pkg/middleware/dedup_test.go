@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+)
+
+func TestDedupMiddleware(t *testing.T) {
+	tel, _ := telemetry.NewForTesting()
+	handler := DedupMiddleware(tel, time.Minute, ok)
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("message=hi")))
+	}
+
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["duplicate_requests_total"]; got != 1 {
+		t.Errorf("duplicate_requests_total = %v, want 1", got)
+	}
+}
+
+func TestDedupMiddlewareNilTelemetry(t *testing.T) {
+	handler := DedupMiddleware(nil, time.Minute, ok)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("message=hi")))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+)
+
+// DrainMiddleware rejects new requests once draining is set (at the start of
+// graceful shutdown) with the shutting_down backpressure response and
+// Connection: close, so clients on keep-alive connections reconnect to
+// another instance; Retry-After is whatever SetRetryAfter configured for
+// ReasonShuttingDown. Requests already being handled are unaffected.
+// Requests to exemptPaths (e.g. readiness probes, which report the drain
+// themselves) are always served.
+func DrainMiddleware(tel *telemetry.Telemetry, draining *atomic.Bool, exemptPaths []string, next http.Handler) http.Handler {
+	exempt := make(map[string]bool, len(exemptPaths))
+	for _, p := range exemptPaths {
+		exempt[p] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !draining.Load() || exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Connection", "close")
+		WriteBackpressure(tel, w, r, ReasonShuttingDown, 0)
+	})
+}
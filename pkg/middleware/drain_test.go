@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDrainMiddleware(t *testing.T) {
+	var draining atomic.Bool
+	handler := DrainMiddleware(nil, &draining, []string{"/ready"}, ok)
+
+	tests := []struct {
+		name      string
+		draining  bool
+		path      string
+		wantCode  int
+		wantClose bool
+	}{
+		{"serving", false, "/echo", http.StatusOK, false},
+		{"draining", true, "/echo", http.StatusServiceUnavailable, true},
+		{"draining exempt path", true, "/ready", http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draining.Store(tt.draining)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if closed := rec.Header().Get("Connection") == "close"; closed != tt.wantClose {
+				t.Errorf("Connection: close = %t, want %t", closed, tt.wantClose)
+			}
+		})
+	}
+}
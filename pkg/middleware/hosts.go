@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxRejectedHostLen truncates rejected host values recorded in metrics
+	maxRejectedHostLen = 64
+	// maxRejectedHosts caps the distinct rejected host values recorded in metrics
+	maxRejectedHosts = 100
+)
+
+// HostValidationMiddleware rejects requests whose Host header does not match
+// the allowed list with a 400. Patterns may be exact hosts, "*.example.com"
+// to match any subdomain, or "*" to match everything. Requests to exemptPaths
+// (e.g. kubelet probes hitting the pod IP) are never rejected.
+func HostValidationMiddleware(tel *telemetry.Telemetry, allowed, exemptPaths []string, next http.Handler) http.Handler {
+	patterns := make([]string, 0, len(allowed))
+	for _, p := range allowed {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+
+	exempt := make(map[string]bool, len(exemptPaths))
+	for _, p := range exemptPaths {
+		exempt[p] = true
+	}
+
+	rejected := &rejectedHosts{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := stripPort(r.Host)
+		if hostAllowed(host, patterns) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if tel != nil {
+			span := trace.SpanFromContext(r.Context())
+			span.SetStatus(codes.Error, "host not allowed")
+			span.SetAttributes(attribute.String("error.type", "host_not_allowed"))
+			tel.RecordRejectedHost(r.Context(), rejected.label(host))
+		}
+
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	})
+}
+
+// hostAllowed reports whether host matches any of the allowed patterns
+func hostAllowed(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasPrefix(pattern, "*."):
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		case host == pattern:
+			return true
+		}
+	}
+	return false
+}
+
+// stripPort removes the port (and IPv6 brackets) from a Host header value
+func stripPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+// rejectedHosts bounds the cardinality of rejected host metric values
+type rejectedHosts struct {
+	seen telemetry.CounterMap
+}
+
+// label returns the value to record for host, collapsing to "other" once
+// maxRejectedHosts distinct values have been seen
+func (rh *rejectedHosts) label(host string) string {
+	if len(host) > maxRejectedHostLen {
+		host = host[:maxRejectedHostLen]
+	}
+
+	if _, ok := rh.seen.AddBounded(host, 1, maxRejectedHosts); !ok {
+		return "other"
+	}
+	return host
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestHostValidationMiddleware(t *testing.T) {
+	handler := HostValidationMiddleware(nil, []string{"app.example.com", "*.example.com", "::1"}, []string{"/health"}, ok)
+
+	tests := []struct {
+		name string
+		host string
+		path string
+		want int
+	}{
+		{"exact host", "app.example.com", "/", http.StatusOK},
+		{"exact host with port", "app.example.com:8080", "/", http.StatusOK},
+		{"case insensitive", "APP.Example.com", "/", http.StatusOK},
+		{"IPv6 with port", "[::1]:8080", "/", http.StatusOK},
+		{"IPv6 without port", "[::1]", "/", http.StatusOK},
+		{"subdomain wildcard", "api.example.com", "/", http.StatusOK},
+		{"nested subdomain wildcard", "a.b.example.com", "/", http.StatusOK},
+		{"wildcard excludes apex", "example.com", "/", http.StatusBadRequest},
+		{"wildcard excludes lookalike", "evilexample.com", "/", http.StatusBadRequest},
+		{"other host", "attacker.test", "/", http.StatusBadRequest},
+		{"exempt path with bad host", "10.0.0.7:8080", "/health", http.StatusOK},
+		{"exempt path is exact", "10.0.0.7:8080", "/health/deep", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Host %q %s: status = %d, want %d", tt.host, tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostValidationMiddlewareRecordsRejection(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddleware(tel, HostValidationMiddleware(tel, []string{"app.example.com"}, nil, ok))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "attacker.test"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	span := endedSpan(t, spans)
+	if span.Status.Code != codes.Error {
+		t.Errorf("span status = %v, want %v", span.Status.Code, codes.Error)
+	}
+	if got := attrs(span.Attributes)["error.type"].AsString(); got != "host_not_allowed" {
+		t.Errorf("error.type = %q, want host_not_allowed", got)
+	}
+
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["http_rejected_hosts_total"]; got != 1 {
+		t.Errorf("http_rejected_hosts_total = %v, want 1", got)
+	}
+}
+
+func TestRejectedHostsLabel(t *testing.T) {
+	rh := &rejectedHosts{}
+	for i := 0; i < maxRejectedHosts; i++ {
+		host := fmt.Sprintf("host%d.test", i)
+		if got := rh.label(host); got != host {
+			t.Fatalf("label(%q) = %q before the cap", host, got)
+		}
+	}
+
+	if got := rh.label("one-too-many.test"); got != "other" {
+		t.Errorf("label past the cap = %q, want other", got)
+	}
+	// Hosts seen before the cap keep their own label
+	if got := rh.label("host0.test"); got != "host0.test" {
+		t.Errorf("label(host0.test) = %q, want it kept", got)
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/logging"
+)
+
+// LoggerFromContext returns the request-scoped logger injected by
+// TracingMiddleware, with route attached (plus request_id when
+// RequestIDMiddleware runs inside it); trace_id and span_id are added to
+// each record logged with a context. It falls back to the default logger
+// outside of a traced request. Handlers should log through it.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx)
+}
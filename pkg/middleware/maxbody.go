@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxBodyMiddleware caps request bodies at maxBytes. Requests that declare a
+// larger Content-Length are rejected with a 413 up front; otherwise the body
+// is wrapped with http.MaxBytesReader, so handlers reading past the limit get
+// an *http.MaxBytesError and should respond with WriteBodyTooLarge.
+func MaxBodyMiddleware(tel *telemetry.Telemetry, maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			WriteBodyTooLarge(tel, w, r, &http.MaxBytesError{Limit: maxBytes})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteBodyTooLarge records an oversized body on the request span and writes
+// a 413 response
+func WriteBodyTooLarge(tel *telemetry.Telemetry, w http.ResponseWriter, r *http.Request, err error) {
+	if tel != nil {
+		span := trace.SpanFromContext(r.Context())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "request body too large")
+		span.SetAttributes(attribute.String("error.type", "body_too_large"))
+	}
+
+	http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// readBody reads the whole body the way the echo handler does
+func readBody(tel *telemetry.Telemetry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteBodyTooLarge(tel, w, r, err)
+			return
+		}
+		w.Write(body)
+	})
+}
+
+func TestMaxBodyMiddlewareSmallBody(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddleware(tel, MaxBodyMiddleware(tel, 16, readBody(tel)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello")))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec.Body.String() != "hello" {
+		t.Errorf("body = %q, want %q", rec.Body.String(), "hello")
+	}
+	if span := endedSpan(t, spans); span.Status.Code == codes.Error {
+		t.Errorf("span status = %v, want no error", span.Status.Code)
+	}
+}
+
+func TestMaxBodyMiddlewareOversized(t *testing.T) {
+	tests := []struct {
+		name string
+		// streamed bodies have no Content-Length, so the limit is only hit
+		// while the handler reads
+		streamed bool
+	}{
+		{"declared length", false},
+		{"streamed", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, spans := telemetry.NewForTesting()
+			reached := false
+			handler := TracingMiddleware(tel, MaxBodyMiddleware(tel, 16, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				readBody(tel).ServeHTTP(w, r)
+			})))
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("x", 64)))
+			if tt.streamed {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+			}
+			if reached != tt.streamed {
+				t.Errorf("handler reached = %t, want %t", reached, tt.streamed)
+			}
+
+			span := endedSpan(t, spans)
+			if span.Status.Code != codes.Error {
+				t.Errorf("span status = %v, want %v", span.Status.Code, codes.Error)
+			}
+			if got := attrs(span.Attributes)["error.type"].AsString(); got != "body_too_large" {
+				t.Errorf("error.type = %q, want body_too_large", got)
+			}
+		})
+	}
+}
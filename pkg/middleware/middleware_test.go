@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// endedSpan returns the only span exported so far
+func endedSpan(t *testing.T, spans *tracetest.InMemoryExporter) tracetest.SpanStub {
+	t.Helper()
+	ended := spans.GetSpans()
+	if len(ended) != 1 {
+		t.Fatalf("got %d spans, want 1", len(ended))
+	}
+	return ended[0]
+}
+
+// attrs indexes span attributes by key
+func attrs(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// WantsJSON reports whether the client asked for JSON (application/json or
+// application/problem+json) rather than HTML. Browsers always list
+// text/html, so HTML stays the default for them.
+func WantsJSON(r *http.Request) bool {
+	acceptsJSON, acceptsHTML := false, false
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+		switch mediaType {
+		case "application/json", "application/problem+json":
+			acceptsJSON = true
+		case "text/html":
+			acceptsHTML = true
+		}
+	}
+	return acceptsJSON && !acceptsHTML
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/plain, application/json;q=0.9", true},
+		{"text/html,application/xhtml+xml,application/json;q=0.9,*/*;q=0.8", false},
+		{"text/html", false},
+		{"*/*", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/echo", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := WantsJSON(r); got != tt.want {
+			t.Errorf("WantsJSON(Accept: %q) = %t, want %t", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimitIdleTTL is how long a client's limiter is kept after its last request
+	rateLimitIdleTTL = 10 * time.Minute
+	// rateLimitSweepInterval is how often idle limiters are evicted
+	rateLimitSweepInterval = time.Minute
+	// maxRateLimitClients bounds the per-client state; clients beyond it
+	// share a single overflow bucket until idle entries are evicted
+	maxRateLimitClients = 10000
+)
+
+// RateLimitOptions configures RateLimitMiddleware
+type RateLimitOptions struct {
+	// RPS is the sustained rate each client's bucket refills at
+	RPS float64
+	// Burst is the bucket size
+	Burst int
+	// WarmUp ramps the allowed rate linearly from WarmUpStart*RPS to RPS
+	// over this window after startup, so a cold pod isn't hit with full
+	// load at once; 0 disables the ramp
+	WarmUp      time.Duration
+	WarmUpStart float64
+}
+
+// RateLimitMiddleware applies a token bucket per client IP (see
+// SetTrustedProxies), refilling at opts.RPS tokens per second up to
+// opts.Burst. Requests over the limit get the standard rate_limited
+// backpressure response, which TracingMiddleware counts in http_errors_total
+// like any other 429. The effective rate, which only differs from RPS during
+// the warm-up, is recorded in rate_limit_effective_rps as requests arrive.
+func RateLimitMiddleware(tel *telemetry.Telemetry, opts RateLimitOptions, next http.Handler) http.Handler {
+	start := time.Now()
+	limiters := &clientLimiters{
+		maxLimit:    rate.Limit(opts.RPS),
+		burst:       opts.Burst,
+		clients:     make(map[string]*clientLimiter),
+		start:       start,
+		warmUp:      opts.WarmUp,
+		warmUpStart: opts.WarmUpStart,
+	}
+	limiters.limit = limiters.limitAt(start)
+	if tel != nil {
+		tel.RecordRateLimit(context.Background(), float64(limiters.limit))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		limiter, limitChanged := limiters.get(clientIP(r), now)
+		if limitChanged && tel != nil {
+			tel.RecordRateLimit(r.Context(), float64(limiter.Limit()))
+		}
+		res := limiter.ReserveN(now, 1)
+		if res.OK() && res.DelayFrom(now) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only the delay is wanted; give the token back
+		retryAfter := time.Second
+		if res.OK() {
+			retryAfter = res.DelayFrom(now)
+			res.CancelAt(now)
+		}
+
+		WriteBackpressure(tel, w, r, ReasonRateLimited, retryAfter)
+	})
+}
+
+// clientLimiter is a client's token bucket and when it was last used
+type clientLimiter struct {
+	*rate.Limiter
+	lastSeen time.Time
+}
+
+// clientLimiters holds a token bucket per client, evicting idle ones on a
+// sweep piggybacked on lookups. During the warm-up the current limit is
+// recomputed on each lookup and applied lazily to the limiters handed out.
+type clientLimiters struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	maxLimit  rate.Limit
+	burst     int
+	clients   map[string]*clientLimiter
+	overflow  *rate.Limiter
+	lastSweep time.Time
+
+	start       time.Time
+	warmUp      time.Duration
+	warmUpStart float64
+}
+
+// limitAt returns the allowed rate at now: maxLimit once the warm-up is
+// over, and a linear ramp from warmUpStart*maxLimit before that
+func (c *clientLimiters) limitAt(now time.Time) rate.Limit {
+	elapsed := now.Sub(c.start)
+	if c.warmUp <= 0 || elapsed >= c.warmUp {
+		return c.maxLimit
+	}
+	progress := float64(elapsed) / float64(c.warmUp)
+	fraction := c.warmUpStart + (1-c.warmUpStart)*progress
+	return rate.Limit(fraction) * c.maxLimit
+}
+
+// get returns the limiter for key, creating it if needed, and reports
+// whether the warm-up changed the current limit
+func (c *clientLimiters) get(key string, now time.Time) (*rate.Limiter, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := false
+	if c.limit != c.maxLimit {
+		if limit := c.limitAt(now); limit != c.limit {
+			c.limit, changed = limit, true
+		}
+	}
+	lim := c.lookup(key, now)
+	if lim.Limit() != c.limit {
+		lim.SetLimitAt(now, c.limit)
+	}
+	return lim, changed
+}
+
+// lookup returns the limiter for key, creating it if needed. c.mu must be held.
+func (c *clientLimiters) lookup(key string, now time.Time) *rate.Limiter {
+
+	if now.Sub(c.lastSweep) >= rateLimitSweepInterval {
+		for k, cl := range c.clients {
+			if now.Sub(cl.lastSeen) >= rateLimitIdleTTL {
+				delete(c.clients, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	cl, ok := c.clients[key]
+	if !ok && len(c.clients) >= maxRateLimitClients {
+		if c.overflow == nil {
+			c.overflow = rate.NewLimiter(c.limit, c.burst)
+		}
+		return c.overflow
+	}
+	if !ok {
+		cl = &clientLimiter{Limiter: rate.NewLimiter(c.limit, c.burst)}
+		c.clients[key] = cl
+	}
+	cl.lastSeen = now
+	return cl.Limiter
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"golang.org/x/time/rate"
+)
+
+func TestClientLimitersWarmUp(t *testing.T) {
+	start := time.Now()
+	c := &clientLimiters{
+		maxLimit:    100,
+		burst:       1,
+		clients:     make(map[string]*clientLimiter),
+		start:       start,
+		warmUp:      10 * time.Second,
+		warmUpStart: 0.1,
+	}
+	c.limit = c.limitAt(start)
+
+	tests := []struct {
+		elapsed time.Duration
+		want    rate.Limit
+		changed bool
+	}{
+		{0, 10, false},
+		{5 * time.Second, 55, true},
+		{10 * time.Second, 100, true},
+		{time.Minute, 100, false},
+	}
+	for _, tt := range tests {
+		lim, changed := c.get("client", start.Add(tt.elapsed))
+		if got := lim.Limit(); math.Abs(float64(got-tt.want)) > 1e-9 {
+			t.Errorf("after %s: limit = %v, want %v", tt.elapsed, got, tt.want)
+		}
+		if changed != tt.changed {
+			t.Errorf("after %s: changed = %t, want %t", tt.elapsed, changed, tt.changed)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareRecordsEffectiveRate(t *testing.T) {
+	tel, _ := telemetry.NewForTesting()
+	handler := RateLimitMiddleware(tel, RateLimitOptions{RPS: 100, Burst: 10, WarmUp: time.Hour, WarmUpStart: 0.5}, ok)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/echo", nil))
+
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	// A millisecond into an hour-long ramp the rate has barely moved
+	if got := snap.Values["rate_limit_effective_rps"]; got < 50 || got > 51 {
+		t.Errorf("rate_limit_effective_rps = %v, want ~50", got)
+	}
+}
+
+func TestRateLimitMiddlewareBurst(t *testing.T) {
+	tel, _ := telemetry.NewForTesting()
+	handler := TracingMiddleware(tel, RateLimitMiddleware(tel, RateLimitOptions{RPS: 0.001, Burst: 3}, ok))
+
+	for i := 1; i <= 4; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/echo", nil))
+
+		want := http.StatusOK
+		if i == 4 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i, rec.Code, want)
+		}
+	}
+
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	// The 429 is counted once, by TracingMiddleware
+	if got := snap.Values["http_errors_total"]; got != 1 {
+		t.Errorf("http_errors_total = %v, want 1", got)
+	}
+}
+
+func TestClientLimitersRefill(t *testing.T) {
+	start := time.Now()
+	c := &clientLimiters{
+		limit:    2,
+		maxLimit: 2,
+		burst:    2,
+		clients:  make(map[string]*clientLimiter),
+		start:    start,
+	}
+
+	lim, _ := c.get("client", start)
+	if !lim.AllowN(start, 1) || !lim.AllowN(start, 1) {
+		t.Fatal("burst of 2 was not allowed")
+	}
+	if lim.AllowN(start, 1) {
+		t.Fatal("request beyond the burst was allowed")
+	}
+
+	// At 2 RPS one token comes back every 500ms
+	if lim.AllowN(start.Add(400*time.Millisecond), 1) {
+		t.Error("allowed before a token refilled")
+	}
+	if !lim.AllowN(start.Add(500*time.Millisecond), 1) {
+		t.Error("not allowed after a token refilled")
+	}
+
+	// Other clients have their own bucket
+	if other, _ := c.get("other", start); !other.AllowN(start, 1) {
+		t.Error("another client was limited")
+	}
+}
+
+func TestRateLimitMiddlewareIgnoresForgedForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		xff     []string
+	}{
+		// The client rotates the entry it controls; the load balancer's
+		// stays put
+		{"behind trusted proxy", []string{"192.0.2.0/24"}, []string{"1.1.1.1, 203.0.113.7", "2.2.2.2, 203.0.113.7"}},
+		// Without a trusted proxy the header is the client's to forge
+		{"no trusted proxy", nil, []string{"203.0.113.7", "203.0.113.8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTrustedProxies(t, tt.trusted...)
+			handler := RateLimitMiddleware(nil, RateLimitOptions{RPS: 0.001, Burst: 1}, ok)
+
+			for i, xff := range tt.xff {
+				req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+				req.Header.Set("X-Forwarded-For", xff)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				want := http.StatusOK
+				if i == 1 {
+					want = http.StatusTooManyRequests
+				}
+				if rec.Code != want {
+					t.Errorf("X-Forwarded-For %q: status = %d, want %d", xff, rec.Code, want)
+				}
+			}
+		})
+	}
+}
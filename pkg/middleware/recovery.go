@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecoveryMiddleware recovers panics from next, records them on the request
+// span and in panics_total, logs the stack trace and responds with 500:
+// problem+json carrying the trace ID for API clients, plain text for
+// browsers. It must run inside TracingMiddleware so the span is still open.
+func RecoveryMiddleware(tel *telemetry.Telemetry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// ErrAbortHandler is net/http's sanctioned way to abort a response
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			ctx := r.Context()
+			err := fmt.Errorf("panic: %v", rec)
+
+			LoggerFromContext(ctx).ErrorContext(ctx, "panic recovered",
+				"error", err.Error(),
+				"stack", string(debug.Stack()),
+			)
+
+			if tel != nil {
+				span := trace.SpanFromContext(ctx)
+				span.RecordError(err, trace.WithStackTrace(true))
+				span.SetStatus(codes.Error, "panic recovered")
+				span.SetAttributes(attribute.String("error.type", "panic"))
+
+				// The 500 itself is counted in http_errors_total by
+				// TracingMiddleware; the panic gets its own counter
+				tel.RecordPanic(ctx, r.Method)
+			}
+
+			writePanicResponse(w, r)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writePanicResponse writes the 500 for a recovered panic in the format the
+// client negotiated via Accept
+func writePanicResponse(w http.ResponseWriter, r *http.Request) {
+	if !WantsJSON(r) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	body := problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+		Detail: "The server encountered an unexpected error.",
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		body.TraceID = sc.TraceID().String()
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(body)
+}
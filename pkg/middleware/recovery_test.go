@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestRecoveryMiddlewarePanic(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	handler := TracingMiddleware(tel, RecoveryMiddleware(tel, panicking))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/echo", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["panics_total"]; got != 1 {
+		t.Errorf("panics_total = %v, want 1", got)
+	}
+	// The 500 is counted once, by TracingMiddleware
+	if got := snap.Values["http_errors_total"]; got != 1 {
+		t.Errorf("http_errors_total = %v, want 1", got)
+	}
+
+	ended := spans.GetSpans()
+	if len(ended) != 1 {
+		t.Fatalf("got %d spans, want 1", len(ended))
+	}
+	if ended[0].Status.Code != codes.Error {
+		t.Errorf("span status = %v, want %v", ended[0].Status.Code, codes.Error)
+	}
+}
+
+func TestRecoveryMiddlewareAbortHandler(t *testing.T) {
+	handler := RecoveryMiddleware(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", rec)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestRecoveryMiddlewareNegotiatesFormat(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddleware(tel, RecoveryMiddleware(tel, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{"api client", "application/json", "application/problem+json"},
+		{"problem client", "application/problem+json", "application/problem+json"},
+		{"browser", "text/html,application/xhtml+xml,application/json;q=0.9,*/*;q=0.8", "text/plain"},
+		{"no accept", "", "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Fatalf("Content-Type = %q, want %s", ct, tt.contentType)
+			}
+			if tt.contentType != "application/problem+json" {
+				return
+			}
+
+			var body problem
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Status != http.StatusInternalServerError {
+				t.Errorf("body status = %d, want %d", body.Status, http.StatusInternalServerError)
+			}
+			if want := spans.GetSpans()[0].SpanContext.TraceID().String(); body.TraceID != want {
+				t.Errorf("trace_id = %q, want %q", body.TraceID, want)
+			}
+		})
+	}
+
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["panics_total"]; got != float64(len(tests)) {
+		t.Errorf("panics_total = %v, want %d", got, len(tests))
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestIDLength caps incoming request IDs so a client cannot inflate
+// every log line and span
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key for the request ID
+type requestIDKey struct{}
+
+// RequestIDMiddleware assigns each request an ID, reusing a well-formed
+// incoming X-Request-ID header or generating a v4 UUID otherwise. The ID is
+// stored in the context, echoed in the X-Request-ID response header, set as
+// the request.id span attribute and added to the request-scoped logger.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newUUID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request.id", id))
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logging.WithContext(ctx, logging.FromContext(ctx).With("request_id", id))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the ID assigned by RequestIDMiddleware, or ""
+// if the request did not pass through it
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether id is non-empty, bounded and printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/logging"
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+)
+
+func TestRequestScopedLoggerFields(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+
+	var buf bytes.Buffer
+	logs := logging.New(&buf, "test")
+	handler := TracingMiddlewareWithOptions(tel,
+		RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logging.FromContext(r.Context()).InfoContext(r.Context(), "handled")
+		})),
+		WithRouteResolver(func(*http.Request) string { return "/echo" }),
+	)
+	// Stand in for the process-wide logger so the output can be inspected
+	withLogger := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(logging.WithContext(r.Context(), logs)))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/echo?message=hi", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	withLogger.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", buf.String(), err)
+	}
+
+	span := endedSpan(t, spans)
+	want := map[string]string{
+		"msg":        "handled",
+		"service":    "test",
+		"route":      "/echo",
+		"request_id": "req-123",
+		"trace_id":   span.SpanContext.TraceID().String(),
+		"span_id":    span.SpanContext.SpanID().String(),
+	}
+	for key, value := range want {
+		if got := record[key]; got != value {
+			t.Errorf("%s = %v, want %q", key, got, value)
+		}
+	}
+}
+
+// uuidV4Re matches a lowercase version 4 UUID
+var uuidV4Re = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		generate bool
+	}{
+		{"pass-through", "req-123", false},
+		{"missing", "", true},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), true},
+		{"not printable", "req 123", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, spans := telemetry.NewForTesting()
+			var fromContext string
+			handler := TracingMiddleware(tel, RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = RequestIDFromContext(r.Context())
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get("X-Request-ID")
+			if tt.generate && !uuidV4Re.MatchString(id) {
+				t.Errorf("X-Request-ID = %q, want a generated v4 UUID", id)
+			}
+			if !tt.generate && id != tt.incoming {
+				t.Errorf("X-Request-ID = %q, want %q", id, tt.incoming)
+			}
+			if fromContext != id {
+				t.Errorf("RequestIDFromContext() = %q, want %q", fromContext, id)
+			}
+			if got := attrs(endedSpan(t, spans).Attributes)["request.id"].AsString(); got != id {
+				t.Errorf("request.id = %q, want %q", got, id)
+			}
+		})
+	}
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+
+	var buf bytes.Buffer
+	handler := TracingMiddleware(tel, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFromContext(r.Context()).InfoContext(r.Context(), "handled")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(logging.WithContext(req.Context(), logging.New(&buf, "test"))))
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", buf.String(), err)
+	}
+	if got, want := record["trace_id"], endedSpan(t, spans).SpanContext.TraceID().String(); got != want {
+		t.Errorf("trace_id = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import "net/http"
+
+// RouteResolver maps a request to a low-cardinality route label (e.g.
+// "/users/{id}" rather than "/users/42") for span names and the http.route
+// metric attribute. An empty result means the request did not match a route.
+type RouteResolver func(r *http.Request) string
+
+// MuxRouteResolver resolves routes to the pattern registered on mux that
+// serves the request, so a subtree like "/debug/status/" collapses to a single
+// label however many paths it serves. Requests mux cannot match are passed to
+// fallback when given.
+func MuxRouteResolver(mux *http.ServeMux, fallback RouteResolver) RouteResolver {
+	return func(r *http.Request) string {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return pattern
+		}
+		if fallback != nil {
+			return fallback(r)
+		}
+		return ""
+	}
+}
+
+// resolveRoute returns the route label for r, using the raw path when no
+// resolver is configured or it does not match
+func resolveRoute(resolve RouteResolver, r *http.Request) string {
+	if resolve != nil {
+		if route := resolve(r); route != "" {
+			return route
+		}
+	}
+	return r.URL.Path
+}
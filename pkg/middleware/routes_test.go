@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+)
+
+func TestMuxRouteResolver(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/static/", ok)
+	mux.Handle("/echo", ok)
+	resolve := MuxRouteResolver(mux, func(*http.Request) string { return "fallback" })
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/static/a.css", "/static/"},
+		{"/static/b/c.js", "/static/"},
+		{"/echo", "/echo"},
+		{"/missing", "fallback"},
+	}
+
+	for _, tt := range tests {
+		if got := resolve(httptest.NewRequest(http.MethodGet, tt.path, nil)); got != tt.want {
+			t.Errorf("route(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMuxRouteResolverNamesSpans(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	mux := http.NewServeMux()
+	mux.Handle("/static/", ok)
+	handler := TracingMiddlewareWithOptions(tel, mux, WithRouteResolver(MuxRouteResolver(mux, nil)))
+
+	for _, path := range []string{"/static/a.css", "/static/b/c.js"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	ended := spans.GetSpans()
+	if len(ended) != 2 {
+		t.Fatalf("got %d spans, want 2", len(ended))
+	}
+	for _, s := range ended {
+		if s.Name != "/static/" {
+			t.Errorf("span name = %q, want %q", s.Name, "/static/")
+		}
+		if got := attrs(s.Attributes)["http.route"].AsString(); got != "/static/" {
+			t.Errorf("http.route = %q, want %q", got, "/static/")
+		}
+	}
+}
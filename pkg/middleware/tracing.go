@@ -1,12 +1,20 @@
 package middleware
 
 import (
+	"bufio"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/gabrielsilvao/challenge1-app/pkg/logging"
 	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -32,46 +40,270 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush implements http.Flusher, delegating to the underlying writer when it
+// supports flushing and doing nothing otherwise
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, returning http.ErrNotSupported when the
+// underlying writer can't be hijacked
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// ReadFrom implements io.ReaderFrom so the underlying writer can still use
+// its optimized copy (e.g. sendfile), while counting the bytes written
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		// Hide our own ReadFrom from io.Copy to avoid recursing
+		n, err = io.Copy(struct{ io.Writer }{rw.ResponseWriter}, src)
+	}
+	rw.written += n
+	return n, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Option configures TracingMiddlewareWithOptions
+type Option func(*tracingConfig)
+
+// tracingConfig holds the settings applied by Option
+type tracingConfig struct {
+	resolve   RouteResolver
+	skipPaths []string
+	hooks     []func(*http.Request) []attribute.KeyValue
+	excluded  map[attribute.Key]bool
+
+	requestHeaders  []string
+	responseHeaders []string
+	baggageKeys     []string
+}
+
+// WithRouteResolver names spans and labels metrics with the route from
+// resolve instead of the raw path
+func WithRouteResolver(resolve RouteResolver) Option {
+	return func(c *tracingConfig) {
+		c.resolve = resolve
+	}
+}
+
+// WithSkipPaths serves requests to any of paths or below them (e.g. kubelet
+// probes) without creating a span or recording request metrics. Paths match
+// whole segments, so "/health" skips "/health/live" but not "/healthz".
+func WithSkipPaths(paths ...string) Option {
+	return func(c *tracingConfig) {
+		c.skipPaths = append(c.skipPaths, paths...)
+	}
+}
+
+// pathHasPrefix reports whether path is prefix or a path below it
+func pathHasPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// WithAttributeHook adds the attributes returned by hook to every server
+// span when it starts, e.g. a tenant ID taken from a request header
+func WithAttributeHook(hook func(*http.Request) []attribute.KeyValue) Option {
+	return func(c *tracingConfig) {
+		c.hooks = append(c.hooks, hook)
+	}
+}
+
+// WithExcludedAttributes drops the given default attributes (e.g.
+// "http.user_agent") from server spans. Attributes added by hooks are kept.
+func WithExcludedAttributes(keys ...string) Option {
+	return func(c *tracingConfig) {
+		if c.excluded == nil {
+			c.excluded = make(map[attribute.Key]bool, len(keys))
+		}
+		for _, k := range keys {
+			c.excluded[attribute.Key(k)] = true
+		}
+	}
+}
+
+// sensitiveHeaders are never recorded, even when allow-listed
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// WithRequestHeaders records the named request headers on the server span as
+// http.request.header.<name>. Names match case-insensitively; credentials
+// headers (Authorization, Cookie, ...) are ignored.
+func WithRequestHeaders(names ...string) Option {
+	return func(c *tracingConfig) {
+		c.requestHeaders = appendHeaderNames(c.requestHeaders, names)
+	}
+}
+
+// WithResponseHeaders records the named response headers on the server span
+// as http.response.header.<name>, with the same rules as WithRequestHeaders
+func WithResponseHeaders(names ...string) Option {
+	return func(c *tracingConfig) {
+		c.responseHeaders = appendHeaderNames(c.responseHeaders, names)
+	}
+}
+
+// appendHeaderNames canonicalizes names and appends the non-sensitive ones
+func appendHeaderNames(dst, names []string) []string {
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name != "" && !sensitiveHeaders[name] {
+			dst = append(dst, name)
+		}
+	}
+	return dst
+}
+
+// headerAttrs returns an attribute for each allow-listed header present in h,
+// joining repeated values with ", "
+func headerAttrs(prefix string, names []string, h http.Header) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, name := range names {
+		if values := h.Values(name); len(values) > 0 {
+			attrs = append(attrs, attribute.String(prefix+strings.ToLower(name), strings.Join(values, ", ")))
+		}
+	}
+	return attrs
+}
+
+// WithBaggageKeys copies the named members of the incoming W3C baggage onto
+// the server span as baggage.<key>. Members not listed are propagated
+// downstream as usual but never recorded.
+func WithBaggageKeys(keys ...string) Option {
+	return func(c *tracingConfig) {
+		for _, k := range keys {
+			if k = strings.TrimSpace(k); k != "" {
+				c.baggageKeys = append(c.baggageKeys, k)
+			}
+		}
+	}
+}
+
+// baggageAttrs returns an attribute for each allow-listed member of bag
+func baggageAttrs(keys []string, bag baggage.Baggage) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, k := range keys {
+		if m := bag.Member(k); m.Key() != "" {
+			attrs = append(attrs, attribute.String("baggage."+k, m.Value()))
+		}
+	}
+	return attrs
+}
+
+// filter returns attrs without the excluded keys
+func (c *tracingConfig) filter(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if len(c.excluded) == 0 {
+		return attrs
+	}
+	kept := attrs[:0]
+	for _, kv := range attrs {
+		if !c.excluded[kv.Key] {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
 // TracingMiddleware adds tracing and metrics to HTTP handlers
 func TracingMiddleware(tel *telemetry.Telemetry, next http.Handler) http.Handler {
+	return TracingMiddlewareWithOptions(tel, next)
+}
+
+// TracingMiddlewareWithOptions is TracingMiddleware with route resolution,
+// skipped paths and the server span's attributes configured by opts
+func TracingMiddlewareWithOptions(tel *telemetry.Telemetry, next http.Handler, opts ...Option) http.Handler {
+	cfg := &tracingConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		
+
+		for _, prefix := range cfg.skipPaths {
+			if pathHasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
 		// Track active requests
 		tel.StartRequest(r.Context())
 		defer tel.EndRequest(r.Context())
 
-		// Create a span for this request
-		ctx, span := tel.Tracer.Start(r.Context(), r.URL.Path,
+		// Continue the caller's trace if it sent a traceparent header
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		// Name the span after the route so templated paths share one name
+		route := resolveRoute(cfg.resolve, r)
+		attrs := cfg.filter([]attribute.KeyValue{
+			attribute.String("http.method", r.Method),
+			attribute.String("http.url", r.URL.String()),
+			attribute.String("http.target", r.URL.Path),
+			attribute.String("http.route", route),
+			attribute.String("http.host", r.Host),
+			attribute.String("http.user_agent", r.UserAgent()),
+			attribute.String("http.remote_addr", r.RemoteAddr),
+			attribute.String("http.scheme", getScheme(r)),
+		})
+		attrs = append(attrs, headerAttrs("http.request.header.", cfg.requestHeaders, r.Header)...)
+		attrs = append(attrs, baggageAttrs(cfg.baggageKeys, baggage.FromContext(ctx))...)
+		for _, hook := range cfg.hooks {
+			attrs = append(attrs, hook(r)...)
+		}
+		ctx, span := tel.Tracer.Start(ctx, route,
 			trace.WithSpanKind(trace.SpanKindServer),
-			trace.WithAttributes(
-				attribute.String("http.method", r.Method),
-				attribute.String("http.url", r.URL.String()),
-				attribute.String("http.host", r.Host),
-				attribute.String("http.user_agent", r.UserAgent()),
-				attribute.String("http.remote_addr", r.RemoteAddr),
-				attribute.String("http.scheme", getScheme(r)),
-			),
+			trace.WithAttributes(attrs...),
 		)
 		defer span.End()
+		tel.RecordSpanStarted(ctx, span.SpanContext().IsSampled())
 
 		// Wrap response writer to capture status code
 		rw := newResponseWriter(w)
 
-		// Add trace ID to response headers
+		// Add trace ID to response headers unless disabled for hardened deployments
 		traceID := span.SpanContext().TraceID().String()
-		rw.Header().Set("X-Trace-ID", traceID)
+		if tel.Config == nil || tel.Config.ExposeTraceID {
+			rw.Header().Set("X-Trace-ID", traceID)
+		}
+
+		// Attach a request-scoped logger carrying correlation fields
+		// (trace_id and span_id are added per record by the logging handler)
+		ctx = logging.WithContext(ctx, logging.FromContext(ctx).With("route", route))
 
 		// Call the next handler
 		next.ServeHTTP(rw, r.WithContext(ctx))
 
 		// Record span attributes after handler execution
 		duration := time.Since(start)
-		span.SetAttributes(
+		span.SetAttributes(cfg.filter([]attribute.KeyValue{
 			attribute.Int("http.status_code", rw.statusCode),
 			attribute.Int64("http.response_size", rw.written),
 			attribute.Float64("http.duration_ms", float64(duration.Milliseconds())),
-		)
+		})...)
+		span.SetAttributes(headerAttrs("http.response.header.", cfg.responseHeaders, rw.Header())...)
 
 		// Set span status based on HTTP status code
 		if rw.statusCode >= 400 {
@@ -93,7 +325,7 @@ func TracingMiddleware(tel *telemetry.Telemetry, next http.Handler) http.Handler
 		)
 
 		// Record metrics
-		tel.RecordRequest(ctx, r.Method, r.URL.Path, rw.statusCode, duration)
+		tel.RecordRequest(ctx, r.Method, route, rw.statusCode, duration)
 	})
 }
 
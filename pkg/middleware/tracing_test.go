@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ok responds 200 with an empty body
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestTracingMiddlewareExposeTraceID(t *testing.T) {
+	for _, expose := range []bool{true, false} {
+		tel, spans := telemetry.NewForTesting()
+		tel.Config.ExposeTraceID = expose
+
+		rec := httptest.NewRecorder()
+		TracingMiddleware(tel, ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		got := rec.Header().Get("X-Trace-ID")
+		switch {
+		case expose && got != endedSpan(t, spans).SpanContext.TraceID().String():
+			t.Errorf("ExposeTraceID=true: X-Trace-ID = %q, want the span's trace ID", got)
+		case !expose && got != "":
+			t.Errorf("ExposeTraceID=false: X-Trace-ID = %q, want none", got)
+		}
+	}
+}
+
+func TestTracingMiddlewareTraceparentFlags(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	for _, tt := range []struct {
+		flags   string
+		sampled bool
+	}{
+		{"01", true},
+		{"00", false},
+	} {
+		tel, spans := telemetry.NewForTesting()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-"+tt.flags)
+		rec := httptest.NewRecorder()
+		TracingMiddleware(tel, ok).ServeHTTP(rec, req)
+
+		// The trace continues either way; only recording follows the flag
+		if got := rec.Header().Get("X-Trace-ID"); got != traceID {
+			t.Errorf("flags %s: X-Trace-ID = %q, want %q", tt.flags, got, traceID)
+		}
+		if got := len(spans.GetSpans()) == 1; got != tt.sampled {
+			t.Errorf("flags %s: span exported = %t, want %t", tt.flags, got, tt.sampled)
+		}
+
+		snap, err := tel.Snapshot(context.Background())
+		if err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+		want := 0.0
+		if tt.sampled {
+			want = 1
+		}
+		if snap.Values["spans_started_total"] != 1 || snap.Values["spans_sampled_total"] != want {
+			t.Errorf("flags %s: spans started/sampled = %v/%v, want 1/%v", tt.flags,
+				snap.Values["spans_started_total"], snap.Values["spans_sampled_total"], want)
+		}
+	}
+}
+
+func TestTracingMiddlewareContinuesRemoteTrace(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	TracingMiddleware(tel, ok).ServeHTTP(httptest.NewRecorder(), req)
+
+	span := endedSpan(t, spans)
+	if got := span.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("TraceID = %s, want the incoming trace ID", got)
+	}
+	if got := span.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent SpanID = %s, want the incoming span ID", got)
+	}
+	if !span.Parent.IsRemote() {
+		t.Error("parent IsRemote() = false, want true")
+	}
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := newResponseWriter(rec)
+
+	rw.Write([]byte("event: ping\n\n"))
+	rw.Flush()
+
+	if !rec.Flushed {
+		t.Error("Flush() did not reach the underlying writer")
+	}
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	tel, _ := telemetry.NewForTesting()
+	handler := TracingMiddleware(tel, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() = %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\nhello")
+		buf.Flush()
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	got := make([]byte, len("hello"))
+	if _, err := io.ReadFull(reader, got); err != nil || string(got) != "hello" {
+		t.Errorf("after upgrade read %q, %v; want hello", got, err)
+	}
+}
+
+func TestResponseWriterHijackNotSupported(t *testing.T) {
+	rw := newResponseWriter(httptest.NewRecorder())
+	if _, _, err := rw.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Hijack() = %v, want http.ErrNotSupported", err)
+	}
+}
+
+func TestTracingMiddlewareSkipPaths(t *testing.T) {
+	tests := []struct {
+		path    string
+		skipped bool
+	}{
+		{"/health", true},
+		{"/health/live", true},
+		{"/ready", true},
+		{"/healthz-admin", false},
+		{"/readyz", false},
+		{"/echo", false},
+	}
+
+	for _, tt := range tests {
+		tel, spans := telemetry.NewForTesting()
+		handler := TracingMiddlewareWithOptions(tel, ok, WithSkipPaths("/health", "/ready"))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		snap, err := tel.Snapshot(context.Background())
+		if err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+		traced := len(spans.GetSpans()) == 1
+		counted := snap.Values["http_requests_total"] == 1
+		if traced == tt.skipped || counted == tt.skipped {
+			t.Errorf("%s: traced = %t, counted = %t; want skipped = %t", tt.path, traced, counted, tt.skipped)
+		}
+	}
+}
+
+func TestTracingMiddlewareAttributeHookAndExclusion(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddlewareWithOptions(tel, ok,
+		WithAttributeHook(func(r *http.Request) []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.String("tenant.id", r.Header.Get("X-Tenant-ID"))}
+		}),
+		WithExcludedAttributes("http.user_agent"),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set("User-Agent", "curl/8.0")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := attrs(endedSpan(t, spans).Attributes)
+	if v := got["tenant.id"].AsString(); v != "acme" {
+		t.Errorf("tenant.id = %q, want acme", v)
+	}
+	if v, found := got["http.user_agent"]; found {
+		t.Errorf("http.user_agent = %q recorded, want excluded", v.AsString())
+	}
+	if _, found := got["http.method"]; !found {
+		t.Error("http.method missing; only the excluded attribute should be dropped")
+	}
+}
+
+func TestTracingMiddlewareRecordsAllowListedHeaders(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddlewareWithOptions(tel, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Set-Cookie", "session=secret")
+	}),
+		WithRequestHeaders("x-client-version", "Authorization"),
+		WithResponseHeaders("Cache-Control", "Set-Cookie"),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set("X-Client-Version", "1.4.2")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Other", "not listed")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := attrs(endedSpan(t, spans).Attributes)
+	want := map[attribute.Key]string{
+		"http.request.header.x-client-version": "1.4.2",
+		"http.response.header.cache-control":   "no-store",
+	}
+	for key, v := range want {
+		if got[key].AsString() != v {
+			t.Errorf("%s = %q, want %q", key, got[key].AsString(), v)
+		}
+	}
+	// Unlisted headers are skipped, and credentials even when allow-listed
+	for _, key := range []attribute.Key{
+		"http.request.header.authorization",
+		"http.request.header.x-other",
+		"http.response.header.set-cookie",
+	} {
+		if v, found := got[key]; found {
+			t.Errorf("%s = %q recorded, want omitted", key, v.AsString())
+		}
+	}
+}
+
+func TestTracingMiddlewareRecordsAllowListedBaggage(t *testing.T) {
+	tel, spans := telemetry.NewForTesting()
+	handler := TracingMiddlewareWithOptions(tel, ok, WithBaggageKeys("tenant", "plan"))
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set("Baggage", "tenant=acme,user.email=jane%40example.com")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := attrs(endedSpan(t, spans).Attributes)
+	if v := got["baggage.tenant"].AsString(); v != "acme" {
+		t.Errorf("baggage.tenant = %q, want acme", v)
+	}
+	if v, found := got["baggage.user.email"]; found {
+		t.Errorf("baggage.user.email = %q recorded, want omitted", v.AsString())
+	}
+	// Listed but absent members add nothing
+	if _, found := got["baggage.plan"]; found {
+		t.Error("baggage.plan recorded for a member that was not sent")
+	}
+}
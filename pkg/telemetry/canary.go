@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// canaryAttr marks canary telemetry so it can be told apart from user traffic
+var canaryAttr = attribute.Bool("telemetry.canary", true)
+
+// StartCanary emits a canary span and metric data point on every interval so
+// backends can alert on missing telemetry even with zero user traffic.
+// The returned function stops the ticker and waits for the goroutine to exit;
+// pending data is flushed by Shutdown.
+func (t *Telemetry) StartCanary(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				t.emitCanary(context.Background())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// emitCanary records a single canary span and metric data point
+func (t *Telemetry) emitCanary(ctx context.Context) {
+	ctx, span := t.Tracer.Start(ctx, "canary",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(canaryAttr),
+	)
+	defer span.End()
+
+	t.CanaryCounter.Add(ctx, 1, metric.WithAttributes(canaryAttr))
+}
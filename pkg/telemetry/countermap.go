@@ -0,0 +1,78 @@
+package telemetry
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CounterMap is a concurrency-safe map of string keys to atomic counters.
+// Hot-path updates to existing keys only take a read lock, and Snapshot gives
+// asynchronous callbacks (e.g. observable gauges) a consistent copy to read
+// without racing the writers. The zero value is ready to use.
+type CounterMap struct {
+	mu     sync.RWMutex
+	values map[string]*atomic.Int64
+}
+
+// Add adds delta to key, creating it if needed, and returns the new value
+func (c *CounterMap) Add(key string, delta int64) int64 {
+	v, _ := c.AddBounded(key, delta, 0)
+	return v
+}
+
+// AddBounded adds delta to key like Add, but only creates a new key while
+// the map holds fewer than maxKeys keys (maxKeys <= 0 means unbounded).
+// It reports whether the key exists after the call.
+func (c *CounterMap) AddBounded(key string, delta int64, maxKeys int) (int64, bool) {
+	c.mu.RLock()
+	v, ok := c.values[key]
+	c.mu.RUnlock()
+	if ok {
+		return v.Add(delta), true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok = c.values[key]; !ok {
+		if maxKeys > 0 && len(c.values) >= maxKeys {
+			return 0, false
+		}
+		if c.values == nil {
+			c.values = make(map[string]*atomic.Int64)
+		}
+		v = new(atomic.Int64)
+		c.values[key] = v
+	}
+	return v.Add(delta), true
+}
+
+// Load returns the current value of key, or 0 if it doesn't exist
+func (c *CounterMap) Load(key string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if v, ok := c.values[key]; ok {
+		return v.Load()
+	}
+	return 0
+}
+
+// Len returns the number of keys
+func (c *CounterMap) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.values)
+}
+
+// Snapshot returns a copy of all keys and their current values
+func (c *CounterMap) Snapshot() map[string]int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snap := make(map[string]int64, len(c.values))
+	for k, v := range c.values {
+		snap[k] = v.Load()
+	}
+	return snap
+}
@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCounterMapConcurrent(t *testing.T) {
+	const (
+		workers = 16
+		adds    = 1000
+		keys    = 8
+		maxKeys = 4
+	)
+
+	var counts, bounded CounterMap
+	var writers, readers sync.WaitGroup
+	stop := make(chan struct{})
+
+	// Readers snapshot continuously while the writers run
+	for i := 0; i < 2; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					counts.Snapshot()
+					if n := len(bounded.Snapshot()); n > maxKeys {
+						t.Errorf("bounded snapshot has %d keys, want at most %d", n, maxKeys)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < workers; w++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for i := 0; i < adds; i++ {
+				key := fmt.Sprintf("key-%d", i%keys)
+				counts.Add(key, 1)
+				bounded.AddBounded(key, 1, maxKeys)
+			}
+		}()
+	}
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	snap := counts.Snapshot()
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprintf("key-%d", k)
+		if got, want := snap[key], int64(workers*adds/keys); got != want {
+			t.Errorf("%s = %d, want %d", key, got, want)
+		}
+	}
+
+	if got := bounded.Len(); got != maxKeys {
+		t.Errorf("bounded Len() = %d, want %d", got, maxKeys)
+	}
+	// Keys that made it in count every add; the rest were never created
+	for key, got := range bounded.Snapshot() {
+		if want := int64(workers * adds / keys); got != want {
+			t.Errorf("bounded %s = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestCounterMapAddBounded(t *testing.T) {
+	var c CounterMap
+
+	if v, ok := c.AddBounded("a", 2, 1); !ok || v != 2 {
+		t.Errorf("AddBounded(a) = %d, %t; want 2, true", v, ok)
+	}
+	if _, ok := c.AddBounded("b", 1, 1); ok {
+		t.Error("AddBounded(b) created a key past maxKeys")
+	}
+	// Existing keys keep counting at the bound
+	if v, ok := c.AddBounded("a", 3, 1); !ok || v != 5 {
+		t.Errorf("AddBounded(a) = %d, %t; want 5, true", v, ok)
+	}
+	if got := c.Load("b"); got != 0 {
+		t.Errorf("Load(b) = %d, want 0", got)
+	}
+}
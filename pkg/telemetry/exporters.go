@@ -0,0 +1,159 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Supported exporter selections for Config.Exporter
+const (
+	ExporterOTLP    = "otlp"
+	ExporterFile    = "file"
+	ExporterConsole = "console"
+)
+
+// Supported OTLP transports for Config.Protocol
+const (
+	ProtocolHTTPProtobuf = "http/protobuf"
+	ProtocolGRPC         = "grpc"
+)
+
+// validateExporter checks the configured exporter and protocol selections
+func validateExporter(cfg *Config) error {
+	switch cfg.Exporter {
+	case ExporterOTLP, ExporterFile, ExporterConsole:
+	default:
+		return fmt.Errorf("unsupported exporter %q (expected %q, %q or %q)", cfg.Exporter, ExporterOTLP, ExporterFile, ExporterConsole)
+	}
+
+	switch cfg.Protocol {
+	case ProtocolHTTPProtobuf, ProtocolGRPC:
+		return nil
+	default:
+		return fmt.Errorf("unsupported OTLP protocol %q (expected %q or %q)", cfg.Protocol, ProtocolHTTPProtobuf, ProtocolGRPC)
+	}
+}
+
+// newSpanExporter creates the span exporter selected by cfg.Exporter
+func newSpanExporter(ctx context.Context, cfg *Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterFile:
+		file, err := newRotatingFile(filepath.Join(cfg.ExportFileDir, "traces.jsonl"), cfg.ExportFileMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &fileSpanExporter{SpanExporter: exporter, file: file}, nil
+	case ExporterConsole:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	}
+
+	if cfg.Protocol == ProtocolGRPC {
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint),
+		}
+
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(cfg.OTLPEndpoint),
+	}
+
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// newMetricExporter creates the metric exporter selected by cfg.Exporter
+func newMetricExporter(ctx context.Context, cfg *Config) (sdkmetric.Exporter, error) {
+	switch cfg.Exporter {
+	case ExporterFile:
+		file, err := newRotatingFile(filepath.Join(cfg.ExportFileDir, "metrics.jsonl"), cfg.ExportFileMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdoutmetric.New(stdoutmetric.WithEncoder(json.NewEncoder(file)))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &fileMetricExporter{Exporter: exporter, file: file}, nil
+	case ExporterConsole:
+		enc := json.NewEncoder(os.Stderr)
+		enc.SetIndent("", "  ")
+		return stdoutmetric.New(stdoutmetric.WithEncoder(enc))
+	}
+
+	if cfg.Protocol == ProtocolGRPC {
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(cfg.OTLPEndpoint),
+		}
+
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(cfg.OTLPEndpoint),
+	}
+
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+
+	return otlpmetrichttp.New(ctx, opts...)
+}
+
+// fileSpanExporter closes the output file once the exporter has flushed
+type fileSpanExporter struct {
+	sdktrace.SpanExporter
+	file *rotatingFile
+}
+
+func (e *fileSpanExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if cerr := e.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// fileMetricExporter closes the output file once the exporter has flushed
+type fileMetricExporter struct {
+	sdkmetric.Exporter
+	file *rotatingFile
+}
+
+func (e *fileMetricExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+	if cerr := e.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readJSONLines decodes every line of the files matching pattern
+func readJSONLines(t *testing.T, pattern string) []map[string]interface{} {
+	t.Helper()
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []map[string]interface{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var record map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Errorf("%s: line is not JSON: %v", path, err)
+			}
+			records = append(records, record)
+		}
+		f.Close()
+	}
+	return records
+}
+
+func TestFileExporter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := testConfig()
+	cfg.Exporter = ExporterFile
+	cfg.ExportFileDir = dir
+	cfg.ExportFileMaxBytes = 1 // rotate before every record after the first
+	cfg.PushMetrics = true
+
+	tel, err := New(ctx, WithConfig(cfg))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for _, name := range []string{"first", "second", "third"} {
+		_, span := tel.Tracer.Start(ctx, name)
+		span.End()
+		if err := tel.ForceFlush(ctx); err != nil {
+			t.Fatalf("ForceFlush: %v", err)
+		}
+	}
+	tel.RecordRequest(ctx, "GET", "/", 200, 0)
+	if err := tel.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "traces*.jsonl"))
+	if len(files) != 3 {
+		t.Errorf("got %d trace files, want 3 after rotation: %v", len(files), files)
+	}
+
+	names := make(map[string]bool)
+	for _, record := range readJSONLines(t, filepath.Join(dir, "traces*.jsonl")) {
+		name, _ := record["Name"].(string)
+		names[name] = true
+	}
+	for _, name := range []string{"first", "second", "third"} {
+		if !names[name] {
+			t.Errorf("span %q not written", name)
+		}
+	}
+
+	if records := readJSONLines(t, filepath.Join(dir, "metrics*.jsonl")); len(records) == 0 {
+		t.Error("no metrics written")
+	}
+}
+
+func TestValidateExporter(t *testing.T) {
+	tests := []struct {
+		exporter string
+		protocol string
+		wantErr  bool
+	}{
+		{ExporterOTLP, ProtocolHTTPProtobuf, false},
+		{ExporterOTLP, ProtocolGRPC, false},
+		{ExporterFile, ProtocolHTTPProtobuf, false},
+		{ExporterConsole, ProtocolGRPC, false},
+		{ExporterOTLP, "http/json", true},
+		{ExporterOTLP, "", true},
+		{"zipkin", ProtocolHTTPProtobuf, true},
+	}
+
+	for _, tt := range tests {
+		err := validateExporter(&Config{Exporter: tt.exporter, Protocol: tt.protocol})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateExporter(%q, %q) = %v, want error %t", tt.exporter, tt.protocol, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewConfigProtocol(t *testing.T) {
+	tests := []struct {
+		protocol     string
+		wantProtocol string
+		wantEndpoint string
+	}{
+		{"", ProtocolHTTPProtobuf, "localhost:4318"},
+		{ProtocolHTTPProtobuf, ProtocolHTTPProtobuf, "localhost:4318"},
+		{ProtocolGRPC, ProtocolGRPC, "localhost:4317"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", tt.protocol)
+
+		cfg, err := NewConfig()
+		if err != nil {
+			t.Fatalf("NewConfig() with protocol %q: %v", tt.protocol, err)
+		}
+		if cfg.Protocol != tt.wantProtocol || cfg.OTLPEndpoint != tt.wantEndpoint {
+			t.Errorf("protocol %q: got %s at %s, want %s at %s", tt.protocol, cfg.Protocol, cfg.OTLPEndpoint, tt.wantProtocol, tt.wantEndpoint)
+		}
+	}
+
+	// An unsupported protocol is caught when telemetry is set up
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	cfg, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+	if err := validateExporter(cfg); err == nil {
+		t.Error("validateExporter() = nil, want an error for http/json")
+	}
+}
+
+func TestInitializeConsoleExporter(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER", "")
+	t.Setenv("OTEL_TRACES_EXPORTER", ExporterConsole)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+
+	cfg, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+	if cfg.Exporter != ExporterConsole {
+		t.Fatalf("Exporter = %q, want %q", cfg.Exporter, ExporterConsole)
+	}
+
+	// No collector is listening; the console exporter must not need one
+	ctx := context.Background()
+	tel, err := Initialize(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if err := tel.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
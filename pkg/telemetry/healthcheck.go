@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+const (
+	// initialProbeBackoff is the delay after the first failed collector probe
+	initialProbeBackoff = 500 * time.Millisecond
+	// probeDialTimeout bounds a single collector probe
+	probeDialTimeout = 2 * time.Second
+)
+
+// HealthCheck verifies the OTLP collector is reachable with a TCP dial to the
+// configured endpoint, bounded by ctx. It returns nil when telemetry is not
+// exported over OTLP, since there is no collector to reach.
+func (t *Telemetry) HealthCheck(ctx context.Context) error {
+	if t == nil || t.Config == nil || t.Config.Exporter != ExporterOTLP {
+		return nil
+	}
+
+	return dialCollector(ctx, t.Config.OTLPEndpoint)
+}
+
+// dialCollector opens and closes a TCP connection to endpoint
+func dialCollector(ctx context.Context, endpoint string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("collector unreachable at %s: %w", endpoint, err)
+	}
+	return conn.Close()
+}
+
+// waitForCollector dials the collector until it accepts a connection,
+// backing off exponentially between attempts, so a collector that starts
+// after the app (common on cold starts) does not leave it without telemetry.
+// It gives up after cfg.InitMaxAttempts dials or cfg.InitMaxElapsed,
+// whichever comes first.
+func waitForCollector(ctx context.Context, cfg *Config) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.InitMaxElapsed)
+	defer cancel()
+
+	backoff := initialProbeBackoff
+	for attempt := 1; ; attempt++ {
+		dialCtx, dialCancel := context.WithTimeout(ctx, probeDialTimeout)
+		err := dialCollector(dialCtx, cfg.OTLPEndpoint)
+		dialCancel()
+		if err == nil {
+			return nil
+		}
+		if attempt >= cfg.InitMaxAttempts {
+			return fmt.Errorf("%w (gave up after %d attempts)", err, attempt)
+		}
+
+		log.Printf("Warning: %v (attempt %d/%d, retrying in %s)", err, attempt, cfg.InitMaxAttempts, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up after %s)", err, cfg.InitMaxElapsed)
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,107 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	cfg := testConfig()
+	cfg.OTLPEndpoint = ln.Addr().String()
+	tel := &Telemetry{Config: cfg}
+
+	if err := tel.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck with a listening collector: %v", err)
+	}
+}
+
+func TestHealthCheckClosedListener(t *testing.T) {
+	cfg := testConfig()
+	cfg.OTLPEndpoint = reservePort(t)
+	tel := &Telemetry{Config: cfg}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tel.HealthCheck(ctx); err == nil {
+		t.Error("HealthCheck with a closed listener = nil, want error")
+	}
+}
+
+func TestHealthCheckWithoutCollector(t *testing.T) {
+	cfg := testConfig()
+	cfg.Exporter = ExporterConsole
+	cfg.OTLPEndpoint = "127.0.0.1:1"
+	tel := &Telemetry{Config: cfg}
+
+	if err := tel.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck with the console exporter = %v, want nil", err)
+	}
+	if err := (*Telemetry)(nil).HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck on nil Telemetry = %v, want nil", err)
+	}
+}
+
+// reservePort returns a local address with nothing listening on it
+func reservePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestWaitForCollectorRetriesUntilListening(t *testing.T) {
+	addr := reservePort(t)
+
+	// Attempts are made at 0s, 0.5s and 1.5s; the collector comes up
+	// between the second and the third
+	go func() {
+		time.Sleep(time.Second)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("listen: %v", err)
+			return
+		}
+		t.Cleanup(func() { ln.Close() })
+	}()
+
+	cfg := testConfig()
+	cfg.OTLPEndpoint = addr
+	cfg.InitMaxAttempts = 5
+	cfg.InitMaxElapsed = 10 * time.Second
+
+	start := time.Now()
+	if err := waitForCollector(context.Background(), cfg); err != nil {
+		t.Fatalf("waitForCollector: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 3*initialProbeBackoff {
+		t.Errorf("returned after %s, want the third attempt at %s", elapsed, 3*initialProbeBackoff)
+	}
+}
+
+func TestWaitForCollectorGivesUp(t *testing.T) {
+	cfg := testConfig()
+	cfg.OTLPEndpoint = reservePort(t)
+	cfg.InitMaxAttempts = 2
+	cfg.InitMaxElapsed = 10 * time.Second
+
+	err := waitForCollector(context.Background(), cfg)
+	if err == nil {
+		t.Fatal("waitForCollector = nil, want error")
+	}
+	if !strings.Contains(err.Error(), "gave up after 2 attempts") {
+		t.Errorf("error = %q, want it to report 2 attempts", err)
+	}
+}
@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Option configures New
+type Option func(*options)
+
+// options holds the settings applied by Option
+type options struct {
+	cfg           *Config
+	spanExporter  sdktrace.SpanExporter
+	metricReaders []sdkmetric.Reader
+	resource      *resource.Resource
+
+	// syncExport exports each span as it ends instead of batching, so tests
+	// can inspect spans without ForceFlush
+	syncExport bool
+}
+
+// WithConfig uses cfg instead of reading the config from the environment
+func WithConfig(cfg *Config) Option {
+	return func(o *options) {
+		o.cfg = cfg
+	}
+}
+
+// WithTracerExporter exports spans to exporter (e.g. an in-memory exporter
+// in tests) instead of the exporter selected by the config. Spans are still
+// batched, so call ForceFlush before inspecting it.
+func WithTracerExporter(exporter sdktrace.SpanExporter) Option {
+	return func(o *options) {
+		o.spanExporter = exporter
+	}
+}
+
+// WithMetricReader registers reader on the meter provider in place of the
+// periodic reader for the configured exporter; the Prometheus reader is
+// unaffected. A ManualReader also enables Snapshot. Repeatable.
+func WithMetricReader(reader sdkmetric.Reader) Option {
+	return func(o *options) {
+		o.metricReaders = append(o.metricReaders, reader)
+	}
+}
+
+// WithResource uses res instead of the resource built from the config and
+// OTEL_RESOURCE_ATTRIBUTES
+func WithResource(res *resource.Resource) Option {
+	return func(o *options) {
+		o.resource = res
+	}
+}
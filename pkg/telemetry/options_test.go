@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testConfig returns a config that needs no collector
+func testConfig() *Config {
+	return &Config{
+		ServiceName: "test",
+		Exporter:    ExporterOTLP,
+		Protocol:    ProtocolHTTPProtobuf,
+	}
+}
+
+func TestNewWithInMemoryExporters(t *testing.T) {
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	tel, err := New(ctx,
+		WithConfig(testConfig()),
+		WithTracerExporter(exporter),
+		WithMetricReader(sdkmetric.NewManualReader()),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tel.Shutdown(ctx)
+
+	_, span := tel.Tracer.Start(ctx, "request")
+	span.End()
+	tel.RecordRequest(ctx, "GET", "/", 200, 0)
+
+	// Spans are batched, as in production
+	if err := tel.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+	if got := exporter.GetSpans(); len(got) != 1 || got[0].Name != "request" {
+		t.Errorf("exported spans = %v, want one request span", got)
+	}
+
+	snap, err := tel.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["http_requests_total"]; got != 1 {
+		t.Errorf("http_requests_total = %v, want 1", got)
+	}
+}
+
+func TestNewForTestingUsesParentBasedSampler(t *testing.T) {
+	tel, spans := NewForTesting()
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+		Remote:  true,
+	})
+	_, span := tel.Tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "child")
+	span.End()
+
+	if span.SpanContext().IsSampled() {
+		t.Error("child of an unsampled parent was sampled")
+	}
+	if got := spans.GetSpans(); len(got) != 0 {
+		t.Errorf("exported %d spans, want 0", len(got))
+	}
+}
@@ -0,0 +1,120 @@
+package telemetry
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingFile is an append-only writer that rotates the underlying file once
+// it would grow past maxBytes. Rotated files keep their name with a UTC
+// timestamp inserted before the extension, e.g. traces-20240101T120000.jsonl.
+// Each Write is kept whole, so JSON-lines records never straddle two files.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+// newRotatingFile opens (or creates) path for appending, creating its
+// directory if needed
+func newRotatingFile(path string, maxBytes int64) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	rf := &rotatingFile{path: path, maxBytes: maxBytes}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open export file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat export file: %w", err)
+	}
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would push the file past maxBytes
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.maxBytes > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxBytes {
+		if err := rf.rotate(); err != nil {
+			// Keep the record; an oversized file beats losing telemetry
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// renameFile is os.Rename, replaceable in tests to simulate a failed rotation
+var renameFile = os.Rename
+
+// rotate renames the current file aside and opens a fresh one. The rename
+// happens while the file is still open, so if it fails writing carries on
+// into the current file and the rotation is retried on the next Write.
+func (rf *rotatingFile) rotate() error {
+	// A file removed from under us needs no renaming, just a fresh one
+	if err := renameFile(rf.path, rf.rotatedPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate export file: %w", err)
+	}
+
+	old := rf.file
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// rotatedPath returns an unused name for the file being rotated aside
+func (rf *rotatingFile) rotatedPath() string {
+	ext := filepath.Ext(rf.path)
+	base := fmt.Sprintf("%s-%s", strings.TrimSuffix(rf.path, ext), time.Now().UTC().Format("20060102T150405"))
+
+	rotated := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			return rotated
+		}
+		rotated = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+}
+
+// Close syncs and closes the current file
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	rf.file.Sync()
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "traces.jsonl")
+	rf, err := newRotatingFile(path, 8)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+
+	renameFile = func(string, string) error { return errors.New("disk says no") }
+	t.Cleanup(func() { renameFile = os.Rename })
+
+	// Both records go to the current file while rotation keeps failing
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) during failed rotation: %v", line, err)
+		}
+	}
+
+	// Once renaming works again the next write rotates
+	renameFile = os.Rename
+	if _, err := rf.Write([]byte("third\n")); err != nil {
+		t.Fatalf("Write after recovery: %v", err)
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if got, _ := os.ReadFile(path); string(got) != "third\n" {
+		t.Errorf("current file = %q, want %q", got, "third\n")
+	}
+	rotated, _ := filepath.Glob(filepath.Join(dir, "traces-*.jsonl"))
+	if len(rotated) != 1 {
+		t.Fatalf("got %d rotated files, want 1: %v", len(rotated), rotated)
+	}
+	if got, _ := os.ReadFile(rotated[0]); string(got) != "first\nsecond\n" {
+		t.Errorf("rotated file = %q, want %q", got, "first\nsecond\n")
+	}
+}
+
+func TestRotatingFileRemovedFromUnderneath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "traces.jsonl")
+	rf, err := newRotatingFile(path, 8)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	defer rf.Close()
+
+	rf.Write([]byte("first\n"))
+	os.Remove(path)
+	if _, err := rf.Write([]byte("second\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "second\n" {
+		t.Errorf("current file = %q, want %q", got, "second\n")
+	}
+}
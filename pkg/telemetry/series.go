@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"log"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// seriesGuard tracks the distinct request metric series we have recorded and
+// degrades new recordings to low-cardinality attributes once the configured
+// limit is exceeded, protecting the metrics pipeline from route or status
+// code explosions (e.g. a scan of random paths)
+type seriesGuard struct {
+	limit    int
+	seen     CounterMap
+	degraded sync.Once
+}
+
+func newSeriesGuard(limit int) *seriesGuard {
+	return &seriesGuard{limit: limit}
+}
+
+// requestAttrs returns the attribute set for a request recording. Known
+// series keep full detail; new series past the limit drop the route and
+// exact status code. A nil guard or zero limit disables degradation.
+func (g *seriesGuard) requestAttrs(method, route string, statusCode int) []attribute.KeyValue {
+	full := []attribute.KeyValue{
+		attribute.String("http.method", method),
+		attribute.String("http.route", route),
+		attribute.Int("http.status_code", statusCode),
+	}
+	if g == nil || g.limit <= 0 {
+		return full
+	}
+
+	key := method + " " + route + " " + strconv.Itoa(statusCode)
+	if _, ok := g.seen.AddBounded(key, 1, g.limit); ok {
+		return full
+	}
+
+	g.degraded.Do(func() {
+		log.Printf("Warning: request metric series exceeded limit of %d, dropping http.route and http.status_code from new series", g.limit)
+	})
+
+	return []attribute.KeyValue{
+		attribute.String("http.method", method),
+		attribute.String("http.status_class", strconv.Itoa(statusCode/100)+"xx"),
+	}
+}
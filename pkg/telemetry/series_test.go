@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestSeriesGuardRequestAttrs(t *testing.T) {
+	g := newSeriesGuard(2)
+
+	full := func(method, route string, code int) attribute.Set {
+		return attribute.NewSet(
+			attribute.String("http.method", method),
+			attribute.String("http.route", route),
+			attribute.Int("http.status_code", code),
+		)
+	}
+	degraded := func(method, class string) attribute.Set {
+		return attribute.NewSet(
+			attribute.String("http.method", method),
+			attribute.String("http.status_class", class),
+		)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		code   int
+		want   attribute.Set
+	}{
+		{"first series", "GET", "/", 200, full("GET", "/", 200)},
+		{"second series", "POST", "/echo", 201, full("POST", "/echo", 201)},
+		{"new series past the limit", "GET", "/wp-admin", 404, degraded("GET", "4xx")},
+		{"another new series", "GET", "/echo", 503, degraded("GET", "5xx")},
+		{"known series keeps detail", "GET", "/", 200, full("GET", "/", 200)},
+		{"known series again", "POST", "/echo", 201, full("POST", "/echo", 201)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := attribute.NewSet(g.requestAttrs(tt.method, tt.route, tt.code)...)
+			if !got.Equals(&tt.want) {
+				t.Errorf("requestAttrs(%s, %s, %d) = %v, want %v",
+					tt.method, tt.route, tt.code, got.Encoded(attribute.DefaultEncoder()), tt.want.Encoded(attribute.DefaultEncoder()))
+			}
+		})
+	}
+}
+
+func TestSeriesGuardDisabled(t *testing.T) {
+	for _, g := range []*seriesGuard{nil, newSeriesGuard(0)} {
+		for i, route := range []string{"/a", "/b", "/c"} {
+			got := attribute.NewSet(g.requestAttrs("GET", route, 200+i)...)
+			if _, ok := got.Value("http.route"); !ok {
+				t.Errorf("guard %+v: requestAttrs(GET, %s) dropped http.route", g, route)
+			}
+		}
+	}
+}
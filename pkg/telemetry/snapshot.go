@@ -0,0 +1,83 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// errNoManualReader is returned by Snapshot when no manual reader is registered
+var errNoManualReader = errors.New("metrics snapshot requires a manual reader (see NewForTesting or WithMetricReader)")
+
+// MetricsSnapshot is a point-in-time view of metric values, aggregated across
+// all attribute sets of each instrument
+type MetricsSnapshot struct {
+	// Values holds counter, up/down counter and gauge values by metric name
+	Values map[string]float64
+	// Histograms holds histogram counts and sums by metric name
+	Histograms map[string]HistogramSnapshot
+}
+
+// HistogramSnapshot summarizes a histogram across all attribute sets
+type HistogramSnapshot struct {
+	Count uint64
+	Sum   float64
+}
+
+// Snapshot collects the current metric values from the manual reader, so
+// tests can assert on recorded metrics without an OTLP backend
+func (t *Telemetry) Snapshot(ctx context.Context) (*MetricsSnapshot, error) {
+	if t.manualReader == nil {
+		return nil, errNoManualReader
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := t.manualReader.Collect(ctx, &rm); err != nil {
+		return nil, err
+	}
+
+	snap := &MetricsSnapshot{
+		Values:     make(map[string]float64),
+		Histograms: make(map[string]HistogramSnapshot),
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					snap.Values[m.Name] += float64(dp.Value)
+				}
+			case metricdata.Sum[float64]:
+				for _, dp := range data.DataPoints {
+					snap.Values[m.Name] += dp.Value
+				}
+			case metricdata.Gauge[int64]:
+				for _, dp := range data.DataPoints {
+					snap.Values[m.Name] += float64(dp.Value)
+				}
+			case metricdata.Gauge[float64]:
+				for _, dp := range data.DataPoints {
+					snap.Values[m.Name] += dp.Value
+				}
+			case metricdata.Histogram[int64]:
+				h := snap.Histograms[m.Name]
+				for _, dp := range data.DataPoints {
+					h.Count += dp.Count
+					h.Sum += float64(dp.Sum)
+				}
+				snap.Histograms[m.Name] = h
+			case metricdata.Histogram[float64]:
+				h := snap.Histograms[m.Name]
+				for _, dp := range data.DataPoints {
+					h.Count += dp.Count
+					h.Sum += dp.Sum
+				}
+				snap.Histograms[m.Name] = h
+			}
+		}
+	}
+
+	return snap, nil
+}
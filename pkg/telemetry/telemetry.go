@@ -2,20 +2,32 @@ package telemetry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gabrielsilvao/challenge1-app/pkg/env"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelruntime "go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/codes"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/propagation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -26,28 +38,127 @@ type Config struct {
 	Environment    string
 	OTLPEndpoint   string
 	Insecure       bool
+
+	// Protocol selects the OTLP transport: "http/protobuf" or "grpc"
+	Protocol string
+
+	// Collector probing during Initialize: up to InitMaxAttempts dials with
+	// exponential backoff, giving up after InitMaxElapsed. Zero attempts
+	// skips the probe.
+	InitMaxAttempts int
+	InitMaxElapsed  time.Duration
+
+	// HistogramViews override the bucket boundaries of histogram instruments
+	HistogramViews []HistogramView
+
+	// RouteDurationBuckets gives routes (by their http.route label) their own
+	// duration buckets. Views select instruments, not attribute values, so
+	// each listed route is also recorded into a dedicated histogram (see
+	// routeDurationInstrument) with a view carrying these boundaries;
+	// http_request_duration_seconds still covers every route.
+	RouteDurationBuckets map[string][]float64
+
+	// RuntimeMetrics reports Go runtime metrics alongside request metrics
+	RuntimeMetrics bool
+
+	// Exemplars links metric data points to the sampled span they were
+	// recorded in. The SDK version in use only records exemplars when the
+	// process is started with OTEL_GO_X_EXEMPLAR=true; New does not set it.
+	Exemplars bool
+
+	// Export batching and intervals
+	BatchTimeout         time.Duration
+	MaxExportBatchSize   int
+	MetricExportInterval time.Duration
+
+	// Exporter selects where telemetry is sent: "otlp", "file" or "console".
+	// The file exporter writes JSON lines to ExportFileDir for out-of-band
+	// shipping, rotating each file once it reaches ExportFileMaxBytes. The
+	// console exporter pretty-prints to stderr for local development.
+	Exporter           string
+	ExportFileDir      string
+	ExportFileMaxBytes int64
+
+	// MetricSeriesLimit caps distinct request metric series before route and
+	// status code are dropped from new recordings; 0 disables the guard
+	MetricSeriesLimit int
+
+	// MetricPrefix is prepended to every instrument name, e.g. "challengeapp_"
+	MetricPrefix string
+
+	// ExposeTraceID sets the X-Trace-ID response header on traced requests
+	ExposeTraceID bool
+
+	// PushMetrics registers a periodic reader pushing metrics through the
+	// selected Exporter. PrometheusEnabled registers a Prometheus reader
+	// served by MetricsHandler. Both may be set to scrape and push at once.
+	PushMetrics       bool
+	PrometheusEnabled bool
+
+	// Canary emits a heartbeat span and metric on a schedule
+	CanaryEnabled  bool
+	CanaryInterval time.Duration
 }
 
 // Telemetry holds all telemetry providers and instruments
 type Telemetry struct {
+	Config *Config
+
 	TracerProvider *sdktrace.TracerProvider
 	MeterProvider  *sdkmetric.MeterProvider
 	Tracer         trace.Tracer
 	Meter          metric.Meter
 
+	metricsHandler http.Handler
+	series         *seriesGuard
+	manualReader   *sdkmetric.ManualReader
+	routeDurations map[string]metric.Float64Histogram
+
 	// Custom metrics
-	RequestCounter   metric.Int64Counter
-	RequestDuration  metric.Float64Histogram
-	ActiveRequests   metric.Int64UpDownCounter
-	ErrorCounter     metric.Int64Counter
-	MessageLength    metric.Int64Histogram
+	RequestCounter    metric.Int64Counter
+	RequestDuration   metric.Float64Histogram
+	ActiveRequests    metric.Int64UpDownCounter
+	ErrorCounter      metric.Int64Counter
+	Panics            metric.Int64Counter
+	MessageLength     metric.Int64Histogram
+	CanaryCounter     metric.Int64Counter
+	TemplateTimeouts  metric.Int64Counter
+	RejectedHosts     metric.Int64Counter
+	DuplicateRequests metric.Int64Counter
+	Backpressure      metric.Int64Counter
+	RateLimit         metric.Float64Gauge
+	SpansStarted      metric.Int64Counter
+	SpansSampled      metric.Int64Counter
 }
 
-// NewConfig creates a new telemetry config from environment variables
-func NewConfig() *Config {
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "localhost:4318"
+// HistogramView overrides the bucket boundaries of one histogram instrument.
+// Views select whole instruments, so every series of the instrument (all
+// routes, for http_request_duration_seconds) shares the new boundaries; use
+// Config.RouteDurationBuckets for a single route.
+type HistogramView struct {
+	// Instrument is the instrument name without MetricPrefix, e.g.
+	// "http_request_duration_seconds"
+	Instrument string
+	// Boundaries are the ascending upper bounds of the buckets
+	Boundaries []float64
+}
+
+// NewConfig creates a new telemetry config from environment variables. It
+// fails if the OTLP endpoint is not a valid host:port, optionally prefixed
+// with an http:// or https:// scheme.
+func NewConfig() (*Config, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	if protocol == "" {
+		protocol = ProtocolHTTPProtobuf
+	}
+
+	defaultPort := "4318"
+	if protocol == ProtocolGRPC {
+		defaultPort = "4317"
+	}
+	endpoint, scheme, err := normalizeEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), defaultPort)
+	if err != nil {
+		return nil, err
 	}
 
 	serviceName := os.Getenv("OTEL_SERVICE_NAME")
@@ -65,7 +176,94 @@ func NewConfig() *Config {
 		env = "development"
 	}
 
-	insecure := os.Getenv("OTEL_INSECURE") != "false"
+	// An https endpoint implies a secure transport; otherwise keep the
+	// historical insecure default. An explicit OTEL_INSECURE always wins.
+	insecure := scheme != "https"
+	if v := os.Getenv("OTEL_INSECURE"); v != "" {
+		insecure = v != "false"
+	}
+
+	seriesLimit := 1000
+	if v := os.Getenv("METRIC_SERIES_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			seriesLimit = n
+		}
+	}
+
+	exporter := os.Getenv("OTEL_EXPORTER")
+	if exporter == "" {
+		exporter = ExporterOTLP
+		// Honor the standard env for local development without a collector
+		if os.Getenv("OTEL_TRACES_EXPORTER") == ExporterConsole {
+			exporter = ExporterConsole
+		}
+	}
+
+	exportFileDir := os.Getenv("OTEL_EXPORTER_FILE_DIR")
+	if exportFileDir == "" {
+		exportFileDir = "telemetry"
+	}
+
+	maxExportBatchSize := 512
+	if v := os.Getenv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxExportBatchSize = n
+		}
+	}
+
+	initMaxAttempts := 5
+	if v := os.Getenv("OTEL_INIT_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			initMaxAttempts = n
+		}
+	}
+
+	exportFileMaxBytes := int64(10 << 20)
+	if v := os.Getenv("OTEL_EXPORTER_FILE_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			exportFileMaxBytes = n
+		}
+	}
+
+	// OTEL_METRICS_EXPORTER is a comma-separated list of "otlp",
+	// "prometheus" or "none", anything else is rejected; unset means push
+	// only, plus Prometheus when PROMETHEUS_ENABLED is set
+	pushMetrics := true
+	prometheusEnabled := os.Getenv("PROMETHEUS_ENABLED") == "true"
+	if v := os.Getenv("OTEL_METRICS_EXPORTER"); v != "" {
+		pushMetrics, prometheusEnabled = false, false
+		for _, name := range strings.Split(v, ",") {
+			switch strings.TrimSpace(name) {
+			case "otlp":
+				pushMetrics = true
+			case "prometheus":
+				prometheusEnabled = true
+			case "none":
+			default:
+				return nil, fmt.Errorf("invalid OTEL_METRICS_EXPORTER %q: unsupported exporter %q", v, strings.TrimSpace(name))
+			}
+		}
+	}
+
+	var histogramViews []HistogramView
+	if v := os.Getenv("HTTP_DURATION_BUCKETS"); v != "" {
+		bounds, err := parseBuckets(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTTP_DURATION_BUCKETS %q: %w", v, err)
+		}
+		histogramViews = append(histogramViews, HistogramView{
+			Instrument: "http_request_duration_seconds",
+			Boundaries: bounds,
+		})
+	}
+
+	var routeDurationBuckets map[string][]float64
+	if v := os.Getenv("HTTP_ROUTE_DURATION_BUCKETS"); v != "" {
+		routeDurationBuckets, err = parseRouteBuckets(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTTP_ROUTE_DURATION_BUCKETS %q: %w", v, err)
+		}
+	}
 
 	return &Config{
 		ServiceName:    serviceName,
@@ -73,34 +271,227 @@ func NewConfig() *Config {
 		Environment:    env,
 		OTLPEndpoint:   endpoint,
 		Insecure:       insecure,
+		Protocol:       protocol,
+		Exemplars:      os.Getenv("OTEL_METRICS_EXEMPLAR_FILTER") != "always_off",
+		RuntimeMetrics: os.Getenv("OTEL_GO_RUNTIME_METRICS") != "false",
+		HistogramViews: histogramViews,
+
+		RouteDurationBuckets: routeDurationBuckets,
+
+		InitMaxAttempts: initMaxAttempts,
+		InitMaxElapsed:  envDuration("OTEL_INIT_MAX_ELAPSED", 30*time.Second),
+
+		BatchTimeout:         envDuration("OTEL_BSP_SCHEDULE_DELAY", 5*time.Second),
+		MaxExportBatchSize:   maxExportBatchSize,
+		MetricExportInterval: envDuration("OTEL_METRIC_EXPORT_INTERVAL", 15*time.Second),
+
+		Exporter:           exporter,
+		ExportFileDir:      exportFileDir,
+		ExportFileMaxBytes: exportFileMaxBytes,
+
+		CanaryEnabled:  os.Getenv("CANARY_ENABLED") == "true",
+		CanaryInterval: envDuration("CANARY_INTERVAL", 60*time.Second),
+
+		MetricSeriesLimit: seriesLimit,
+		MetricPrefix:      os.Getenv("METRIC_PREFIX"),
+		ExposeTraceID:     os.Getenv("EXPOSE_TRACE_ID") != "false",
+		PushMetrics:       pushMetrics,
+		PrometheusEnabled: prometheusEnabled,
+	}, nil
+}
+
+// parseBuckets parses comma-separated, strictly ascending bucket boundaries
+// in seconds
+func parseBuckets(v string) ([]float64, error) {
+	var bounds []float64
+	for _, part := range strings.Split(v, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) > 0 && b <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("boundaries must be strictly ascending")
+		}
+		bounds = append(bounds, b)
 	}
+	return bounds, nil
 }
 
-// Initialize sets up OpenTelemetry with tracing and metrics
-func Initialize(ctx context.Context, cfg *Config) (*Telemetry, error) {
-	// Create resource with service information
-	res, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName(cfg.ServiceName),
-			semconv.ServiceVersion(cfg.ServiceVersion),
-			attribute.String("environment", cfg.Environment),
-			attribute.String("telemetry.sdk.language", "go"),
-		),
-	)
+// parseRouteBuckets parses semicolon-separated route=boundaries pairs, e.g.
+// "/echo=0.0001,0.0005,0.001;/upload=1,5,10"
+func parseRouteBuckets(v string) (map[string][]float64, error) {
+	buckets := make(map[string][]float64)
+	for _, entry := range strings.Split(v, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		route, bounds, ok := strings.Cut(entry, "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("entry %q is not route=boundaries", entry)
+		}
+		b, err := parseBuckets(bounds)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route, err)
+		}
+		buckets[route] = b
+	}
+	return buckets, nil
+}
+
+// routeDurationInstrument names the dedicated duration histogram of a route
+// in RouteDurationBuckets, e.g. "http_request_duration_echo_seconds" for
+// "/echo" and "http_request_duration_root_seconds" for "/"
+func routeDurationInstrument(route string) string {
+	slug := strings.Trim(strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return '_'
+	}, route), "_")
+	if slug == "" {
+		slug = "root"
+	}
+	return "http_request_duration_" + slug + "_seconds"
+}
+
+// schemePorts are the ports implied by an endpoint's scheme
+var schemePorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// normalizeEndpoint turns an OTLP endpoint such as "http://collector:4318/"
+// into the host:port the exporters expect, returning the scheme it carried
+// ("" if none). A missing port defaults to the scheme's port (like a URL
+// would) or, without a scheme, to defaultPort; an empty endpoint means
+// localhost.
+func normalizeEndpoint(raw, defaultPort string) (string, string, error) {
+	endpoint := strings.TrimSpace(raw)
+	if endpoint == "" {
+		return net.JoinHostPort("localhost", defaultPort), "", nil
+	}
+
+	var scheme string
+	if s, rest, ok := strings.Cut(endpoint, "://"); ok {
+		scheme = strings.ToLower(s)
+		if scheme != "http" && scheme != "https" {
+			return "", "", fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q: unsupported scheme %q", raw, s)
+		}
+		endpoint = rest
+		defaultPort = schemePorts[scheme]
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	if strings.Contains(endpoint, "/") {
+		return "", "", fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q: must not include a path", raw)
+	}
+
+	host, port, err := net.SplitHostPort(endpoint)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+		// Only a missing port is recoverable
+		if strings.Contains(endpoint, ":") && !strings.HasSuffix(endpoint, "]") {
+			return "", "", fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q: %w", raw, err)
+		}
+		host, port = strings.Trim(endpoint, "[]"), defaultPort
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q: missing host", raw)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q: invalid port %q", raw, port)
+	}
+
+	return net.JoinHostPort(host, port), scheme, nil
+}
+
+// envDuration reads a duration from the environment (see env.Duration),
+// warning and falling back to def when it is invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	d, err := env.Duration(key, def)
+	if err != nil {
+		log.Printf("Warning: %v, using default %s", err, def)
+	}
+	return d
+}
+
+// prometheusNameRe matches valid Prometheus metric names (and prefixes)
+var prometheusNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Initialize sets up OpenTelemetry with tracing and metrics from cfg. It is
+// equivalent to New(ctx, WithConfig(cfg)).
+func Initialize(ctx context.Context, cfg *Config) (*Telemetry, error) {
+	return New(ctx, WithConfig(cfg))
+}
+
+// New sets up OpenTelemetry with tracing and metrics configured by opts. The
+// config defaults to NewConfig() when WithConfig is not given.
+func New(ctx context.Context, opts ...Option) (*Telemetry, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cfg := o.cfg
+	if cfg == nil {
+		var err error
+		if cfg, err = NewConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateExporter(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.PrometheusEnabled && cfg.MetricPrefix != "" && !prometheusNameRe.MatchString(cfg.MetricPrefix) {
+		return nil, fmt.Errorf("invalid metric prefix %q: must match %s", cfg.MetricPrefix, prometheusNameRe)
+	}
+
+	// The OTLP exporters connect lazily, so probe the collector up front
+	// unless the caller supplied its own exporters
+	usesCollector := o.spanExporter == nil || (cfg.PushMetrics && len(o.metricReaders) == 0)
+	if cfg.Exporter == ExporterOTLP && cfg.InitMaxAttempts > 0 && usesCollector {
+		if err := waitForCollector(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create resource with service information. Detectors are applied in
+	// order, so OTEL_RESOURCE_ATTRIBUTES (e.g. deployment.region,
+	// k8s.pod.name) is merged in and our explicit attributes win on conflict.
+	res := o.resource
+	if res == nil {
+		var err error
+		res, err = resource.New(ctx,
+			resource.WithSchemaURL(semconv.SchemaURL),
+			resource.WithTelemetrySDK(),
+			resource.WithFromEnv(),
+			resource.WithAttributes(
+				semconv.ServiceName(cfg.ServiceName),
+				semconv.ServiceVersion(cfg.ServiceVersion),
+				attribute.String("environment", cfg.Environment),
+				attribute.String("telemetry.sdk.language", "go"),
+			),
+		)
+		if errors.Is(err, resource.ErrPartialResource) {
+			// Malformed OTEL_RESOURCE_ATTRIBUTES entries are skipped
+			log.Printf("Warning: partial resource: %v", err)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to create resource: %w", err)
+		}
 	}
 
 	// Initialize trace provider
-	tp, err := initTracerProvider(ctx, cfg, res)
+	tp, err := initTracerProvider(ctx, cfg, res, o.spanExporter, o.syncExport)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize tracer provider: %w", err)
 	}
 
 	// Initialize meter provider
-	mp, err := initMeterProvider(ctx, cfg, res)
+	mp, metricsHandler, err := initMeterProvider(ctx, cfg, res, o.metricReaders)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize meter provider: %w", err)
 	}
@@ -119,131 +510,326 @@ func Initialize(ctx context.Context, cfg *Config) (*Telemetry, error) {
 
 	// Create telemetry instance
 	tel := &Telemetry{
+		Config:         cfg,
 		TracerProvider: tp,
 		MeterProvider:  mp,
 		Tracer:         tracer,
 		Meter:          meter,
+		metricsHandler: metricsHandler,
+		series:         newSeriesGuard(cfg.MetricSeriesLimit),
+	}
+	for _, r := range o.metricReaders {
+		if mr, ok := r.(*sdkmetric.ManualReader); ok {
+			tel.manualReader = mr
+		}
 	}
 
-	// Initialize custom metrics
+	// Initialize custom metrics; failed instruments fall back to no-ops so a
+	// single bad instrument doesn't disable telemetry entirely
 	if err := tel.initMetrics(); err != nil {
-		return nil, fmt.Errorf("failed to initialize metrics: %w", err)
+		log.Printf("Warning: some metrics are unavailable: %v", err)
+	}
+
+	// Go runtime metrics (heap, GC, goroutines) are collected by callbacks
+	// registered on the meter provider, so Shutdown stops them with it
+	if cfg.RuntimeMetrics {
+		if err := otelruntime.Start(otelruntime.WithMeterProvider(tel.MeterProvider)); err != nil {
+			log.Printf("Warning: runtime metrics are unavailable: %v", err)
+		}
 	}
 
 	return tel, nil
 }
 
-// initTracerProvider creates and configures the trace provider
-func initTracerProvider(ctx context.Context, cfg *Config, res *resource.Resource) (*sdktrace.TracerProvider, error) {
-	opts := []otlptracehttp.Option{
-		otlptracehttp.WithEndpoint(cfg.OTLPEndpoint),
-	}
-
-	if cfg.Insecure {
-		opts = append(opts, otlptracehttp.WithInsecure())
+// initTracerProvider creates and configures the trace provider, exporting to
+// exporter or, when nil, to the exporter selected by cfg. Spans are batched
+// unless syncExport is set.
+func initTracerProvider(ctx context.Context, cfg *Config, res *resource.Resource, exporter sdktrace.SpanExporter, syncExport bool) (*sdktrace.TracerProvider, error) {
+	if exporter == nil {
+		var err error
+		if exporter, err = newSpanExporter(ctx, cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	exporter, err := otlptracehttp.New(ctx, opts...)
-	if err != nil {
-		return nil, err
+	processor := sdktrace.WithBatcher(exporter,
+		sdktrace.WithBatchTimeout(cfg.BatchTimeout),
+		sdktrace.WithMaxExportBatchSize(cfg.MaxExportBatchSize),
+	)
+	if syncExport {
+		processor = sdktrace.WithSyncer(exporter)
 	}
 
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter,
-			sdktrace.WithBatchTimeout(5*time.Second),
-			sdktrace.WithMaxExportBatchSize(512),
-		),
+		processor,
 		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		// Honor the sampled flag of an incoming W3C traceparent so upstream
+		// sampling decisions round-trip; root spans are always sampled.
+		// Trace IDs come from the SDK's default generator, which fills all
+		// 16 bytes randomly as W3C Trace Context level 2 expects.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
 	)
 
 	return tp, nil
 }
 
-// initMeterProvider creates and configures the meter provider
-func initMeterProvider(ctx context.Context, cfg *Config, res *resource.Resource) (*sdkmetric.MeterProvider, error) {
-	opts := []otlpmetrichttp.Option{
-		otlpmetrichttp.WithEndpoint(cfg.OTLPEndpoint),
+// initMeterProvider creates and configures the meter provider, registering
+// readers (or, when there are none, a periodic reader for the selected
+// exporter) and/or a Prometheus reader. When Prometheus is enabled the
+// returned handler serves its scrape endpoint.
+func initMeterProvider(ctx context.Context, cfg *Config, res *resource.Resource, readers []sdkmetric.Reader) (*sdkmetric.MeterProvider, http.Handler, error) {
+	if cfg.Exemplars {
+		checkExemplarFlag()
 	}
 
-	if cfg.Insecure {
-		opts = append(opts, otlpmetrichttp.WithInsecure())
+	mpOpts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+	}
+	views := cfg.HistogramViews
+	for route, bounds := range cfg.RouteDurationBuckets {
+		views = append(views, HistogramView{Instrument: routeDurationInstrument(route), Boundaries: bounds})
+	}
+	for _, v := range views {
+		mpOpts = append(mpOpts, sdkmetric.WithView(sdkmetric.NewView(
+			sdkmetric.Instrument{Name: cfg.MetricPrefix + v.Instrument},
+			sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{
+				Boundaries: v.Boundaries,
+			}},
+		)))
 	}
 
-	exporter, err := otlpmetrichttp.New(ctx, opts...)
-	if err != nil {
-		return nil, err
+	for _, r := range readers {
+		mpOpts = append(mpOpts, sdkmetric.WithReader(r))
 	}
 
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(
+	if cfg.PushMetrics && len(readers) == 0 {
+		exporter, err := newMetricExporter(ctx, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		mpOpts = append(mpOpts, sdkmetric.WithReader(
 			sdkmetric.NewPeriodicReader(exporter,
-				sdkmetric.WithInterval(15*time.Second),
+				sdkmetric.WithInterval(cfg.MetricExportInterval),
 			),
-		),
-		sdkmetric.WithResource(res),
-	)
+		))
+	}
 
-	return mp, nil
+	var metricsHandler http.Handler
+	if cfg.PrometheusEnabled {
+		registry := prometheus.NewRegistry()
+		promExporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+		}
+		mpOpts = append(mpOpts, sdkmetric.WithReader(promExporter))
+		// Exemplars are only exposed in the OpenMetrics format
+		metricsHandler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	}
+
+	// Shutting down the provider flushes and closes every registered reader
+	mp := sdkmetric.NewMeterProvider(mpOpts...)
+
+	return mp, metricsHandler, nil
 }
 
-// initMetrics initializes all custom metrics
+// checkExemplarFlag warns when exemplars are requested but the SDK's
+// experimental OTEL_GO_X_EXEMPLAR flag, which this SDK version requires, is
+// not set. The flag belongs to whoever starts the process (the Dockerfile
+// sets it), so it is never set from here. When enabled, sampled spans in the
+// recording context are attached to data points as exemplars
+// (OTEL_METRICS_EXEMPLAR_FILTER selects the filter, trace_based by default).
+func checkExemplarFlag() {
+	if os.Getenv("OTEL_GO_X_EXEMPLAR") != "true" {
+		log.Printf("Warning: exemplars are enabled but OTEL_GO_X_EXEMPLAR is not \"true\", no exemplars will be recorded")
+	}
+}
+
+// initMetrics initializes all custom metrics. Every instrument is attempted;
+// any that fail are logged, replaced with a no-op so callers never see a nil
+// instrument, and reported together in the returned error.
 func (t *Telemetry) initMetrics() error {
 	var err error
+	var errs []error
+
+	// failed logs and collects an instrument creation error
+	failed := func(name string, err error) bool {
+		if err == nil {
+			return false
+		}
+		log.Printf("Warning: failed to create instrument %s: %v (using no-op)", name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		return true
+	}
 
 	// Request counter - counts total HTTP requests
 	t.RequestCounter, err = t.Meter.Int64Counter(
-		"http_requests_total",
+		t.metricName("http_requests_total"),
 		metric.WithDescription("Total number of HTTP requests"),
 		metric.WithUnit("{request}"),
 	)
-	if err != nil {
-		return err
+	if failed("http_requests_total", err) {
+		t.RequestCounter = noop.Int64Counter{}
 	}
 
 	// Request duration histogram
 	t.RequestDuration, err = t.Meter.Float64Histogram(
-		"http_request_duration_seconds",
+		t.metricName("http_request_duration_seconds"),
 		metric.WithDescription("HTTP request duration in seconds"),
 		metric.WithUnit("s"),
 		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
 	)
-	if err != nil {
-		return err
+	if failed("http_request_duration_seconds", err) {
+		t.RequestDuration = noop.Float64Histogram{}
+	}
+
+	// Dedicated duration histograms for routes with their own buckets,
+	// which the views registered by initMeterProvider apply
+	if t.Config != nil && len(t.Config.RouteDurationBuckets) > 0 {
+		t.routeDurations = make(map[string]metric.Float64Histogram, len(t.Config.RouteDurationBuckets))
+		for route := range t.Config.RouteDurationBuckets {
+			name := routeDurationInstrument(route)
+			h, err := t.Meter.Float64Histogram(
+				t.metricName(name),
+				metric.WithDescription("HTTP request duration in seconds for "+route),
+				metric.WithUnit("s"),
+			)
+			if failed(name, err) {
+				continue
+			}
+			t.routeDurations[route] = h
+		}
 	}
 
 	// Active requests gauge
 	t.ActiveRequests, err = t.Meter.Int64UpDownCounter(
-		"http_requests_active",
+		t.metricName("http_requests_active"),
 		metric.WithDescription("Number of active HTTP requests"),
 		metric.WithUnit("{request}"),
 	)
-	if err != nil {
-		return err
+	if failed("http_requests_active", err) {
+		t.ActiveRequests = noop.Int64UpDownCounter{}
 	}
 
 	// Error counter
 	t.ErrorCounter, err = t.Meter.Int64Counter(
-		"http_errors_total",
+		t.metricName("http_errors_total"),
 		metric.WithDescription("Total number of HTTP errors"),
 		metric.WithUnit("{error}"),
 	)
-	if err != nil {
-		return err
+	if failed("http_errors_total", err) {
+		t.ErrorCounter = noop.Int64Counter{}
+	}
+
+	// Panic counter - handler panics turned into 500s by RecoveryMiddleware
+	t.Panics, err = t.Meter.Int64Counter(
+		t.metricName("panics_total"),
+		metric.WithDescription("Total number of recovered handler panics"),
+		metric.WithUnit("{panic}"),
+	)
+	if failed("panics_total", err) {
+		t.Panics = noop.Int64Counter{}
 	}
 
 	// Message length histogram (specific to echo endpoint)
 	t.MessageLength, err = t.Meter.Int64Histogram(
-		"echo_message_length",
+		t.metricName("echo_message_length"),
 		metric.WithDescription("Length of echo messages"),
 		metric.WithUnit("{character}"),
 		metric.WithExplicitBucketBoundaries(0, 10, 50, 100, 500, 1000, 5000),
 	)
-	if err != nil {
-		return err
+	if failed("echo_message_length", err) {
+		t.MessageLength = noop.Int64Histogram{}
 	}
 
-	return nil
+	// Canary counter - heartbeat emitted even with zero user traffic
+	t.CanaryCounter, err = t.Meter.Int64Counter(
+		t.metricName("telemetry_canary_total"),
+		metric.WithDescription("Number of synthetic canary heartbeats emitted"),
+		metric.WithUnit("{heartbeat}"),
+	)
+	if failed("telemetry_canary_total", err) {
+		t.CanaryCounter = noop.Int64Counter{}
+	}
+
+	// Template timeout counter - renders abandoned by the watchdog
+	t.TemplateTimeouts, err = t.Meter.Int64Counter(
+		t.metricName("template_render_timeouts_total"),
+		metric.WithDescription("Total number of template renders that exceeded the time budget"),
+		metric.WithUnit("{render}"),
+	)
+	if failed("template_render_timeouts_total", err) {
+		t.TemplateTimeouts = noop.Int64Counter{}
+	}
+
+	// Rejected host counter - requests failing Host header validation
+	t.RejectedHosts, err = t.Meter.Int64Counter(
+		t.metricName("http_rejected_hosts_total"),
+		metric.WithDescription("Total number of requests rejected for a disallowed Host header"),
+		metric.WithUnit("{request}"),
+	)
+	if failed("http_rejected_hosts_total", err) {
+		t.RejectedHosts = noop.Int64Counter{}
+	}
+
+	// Duplicate request counter - likely client retries within the dedup window
+	t.DuplicateRequests, err = t.Meter.Int64Counter(
+		t.metricName("duplicate_requests_total"),
+		metric.WithDescription("Total number of likely duplicate requests"),
+		metric.WithUnit("{request}"),
+	)
+	if failed("duplicate_requests_total", err) {
+		t.DuplicateRequests = noop.Int64Counter{}
+	}
+
+	// Backpressure counter - requests shed by rate limiting, overload or maintenance
+	t.Backpressure, err = t.Meter.Int64Counter(
+		t.metricName("backpressure_total"),
+		metric.WithDescription("Total number of requests rejected by backpressure"),
+		metric.WithUnit("{request}"),
+	)
+	if failed("backpressure_total", err) {
+		t.Backpressure = noop.Int64Counter{}
+	}
+
+	// Rate limit gauge - the per-client rate currently allowed, which ramps
+	// up during the limiter's warm-up
+	t.RateLimit, err = t.Meter.Float64Gauge(
+		t.metricName("rate_limit_effective_rps"),
+		metric.WithDescription("Per-client request rate currently allowed by the rate limiter"),
+		metric.WithUnit("{request}/s"),
+	)
+	if failed("rate_limit_effective_rps", err) {
+		t.RateLimit = noop.Float64Gauge{}
+	}
+
+	// Span counters - the ratio gives the effective sampling rate
+	t.SpansStarted, err = t.Meter.Int64Counter(
+		t.metricName("spans_started_total"),
+		metric.WithDescription("Total number of server spans started"),
+		metric.WithUnit("{span}"),
+	)
+	if failed("spans_started_total", err) {
+		t.SpansStarted = noop.Int64Counter{}
+	}
+
+	t.SpansSampled, err = t.Meter.Int64Counter(
+		t.metricName("spans_sampled_total"),
+		metric.WithDescription("Total number of server spans sampled"),
+		metric.WithUnit("{span}"),
+	)
+	if failed("spans_sampled_total", err) {
+		t.SpansSampled = noop.Int64Counter{}
+	}
+
+	return errors.Join(errs...)
+}
+
+// metricName applies the configured prefix to an instrument name
+func (t *Telemetry) metricName(name string) string {
+	if t.Config == nil {
+		return name
+	}
+	return t.Config.MetricPrefix + name
 }
 
 // Shutdown gracefully shuts down telemetry providers
@@ -269,33 +855,136 @@ func (t *Telemetry) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-// RecordRequest records metrics for an HTTP request
-func (t *Telemetry) RecordRequest(ctx context.Context, method, path string, statusCode int, duration time.Duration) {
-	attrs := []attribute.KeyValue{
-		attribute.String("http.method", method),
-		attribute.String("http.route", path),
-		attribute.Int("http.status_code", statusCode),
+// ForceFlush exports all spans and metrics recorded so far without shutting
+// the providers down, so requests that completed during server shutdown are
+// not lost
+func (t *Telemetry) ForceFlush(ctx context.Context) error {
+	var errs []error
+
+	if t.TracerProvider != nil {
+		if err := t.TracerProvider.ForceFlush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("tracer provider flush: %w", err))
+		}
 	}
 
+	if t.MeterProvider != nil {
+		if err := t.MeterProvider.ForceFlush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("meter provider flush: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("flush errors: %v", errs)
+	}
+
+	return nil
+}
+
+// Span runs fn inside a named child span of ctx, recording any returned error
+// on the span before ending it. It is safe to call on a nil Telemetry, in
+// which case fn simply runs with ctx.
+func (t *Telemetry) Span(ctx context.Context, name string, fn func(ctx context.Context) error, opts ...trace.SpanStartOption) error {
+	if t == nil {
+		return fn(ctx)
+	}
+
+	ctx, span := t.Tracer.Start(ctx, name, opts...)
+	defer span.End()
+
+	if err := fn(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// MetricsHandler returns the Prometheus scrape handler, or nil when the
+// Prometheus reader is not enabled
+func (t *Telemetry) MetricsHandler() http.Handler {
+	return t.metricsHandler
+}
+
+// RecordRequest records metrics for an HTTP request. The request context may
+// already be canceled (client disconnect), so recording uses a detached copy
+// that keeps its values but never reports cancellation. Keeping the values
+// matters: the active span is what the SDK attaches as the exemplar.
+func (t *Telemetry) RecordRequest(ctx context.Context, method, route string, statusCode int, duration time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+
+	attrs := t.series.requestAttrs(method, route, statusCode)
+
 	t.RequestCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
 	t.RequestDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+	if h, ok := t.routeDurations[route]; ok {
+		h.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+	}
 
 	if statusCode >= 400 {
 		t.ErrorCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
 	}
 }
 
+// RecordPanic records a handler panic recovered by RecoveryMiddleware
+func (t *Telemetry) RecordPanic(ctx context.Context, method string) {
+	t.Panics.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+		attribute.String("http.method", method),
+	))
+}
+
+// RecordRateLimit records the rate limiter's current per-client rate
+func (t *Telemetry) RecordRateLimit(ctx context.Context, rps float64) {
+	t.RateLimit.Record(context.WithoutCancel(ctx), rps)
+}
+
+// RecordSpanStarted counts a started server span and whether it was sampled
+func (t *Telemetry) RecordSpanStarted(ctx context.Context, sampled bool) {
+	t.SpansStarted.Add(ctx, 1)
+	if sampled {
+		t.SpansSampled.Add(ctx, 1)
+	}
+}
+
 // StartRequest increments active requests
 func (t *Telemetry) StartRequest(ctx context.Context) {
 	t.ActiveRequests.Add(ctx, 1)
 }
 
-// EndRequest decrements active requests
+// EndRequest decrements active requests, even if ctx was canceled
 func (t *Telemetry) EndRequest(ctx context.Context) {
-	t.ActiveRequests.Add(ctx, -1)
+	t.ActiveRequests.Add(context.WithoutCancel(ctx), -1)
 }
 
 // RecordMessageLength records the length of echo messages
 func (t *Telemetry) RecordMessageLength(ctx context.Context, length int) {
-	t.MessageLength.Record(ctx, int64(length))
+	t.MessageLength.Record(context.WithoutCancel(ctx), int64(length))
+}
+
+// RecordTemplateTimeout records a template render abandoned by the watchdog
+func (t *Telemetry) RecordTemplateTimeout(ctx context.Context, name string) {
+	t.TemplateTimeouts.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+		attribute.String("template.name", name),
+	))
+}
+
+// RecordRejectedHost records a request rejected by Host header validation
+func (t *Telemetry) RecordRejectedHost(ctx context.Context, host string) {
+	t.RejectedHosts.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+		attribute.String("http.host", host),
+	))
+}
+
+// RecordDuplicateRequest records a request flagged as a likely duplicate
+func (t *Telemetry) RecordDuplicateRequest(ctx context.Context, method, source string) {
+	t.DuplicateRequests.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+		attribute.String("http.method", method),
+		attribute.String("duplicate.source", source),
+	))
+}
+
+// RecordBackpressure records a request rejected by backpressure
+func (t *Telemetry) RecordBackpressure(ctx context.Context, reason string) {
+	t.Backpressure.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+		attribute.String("backpressure.reason", reason),
+	))
 }
@@ -0,0 +1,574 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpan(t *testing.T) {
+	tel, spans := NewForTesting()
+
+	ctx, parent := tel.Tracer.Start(context.Background(), "parent")
+	var child trace.SpanContext
+	err := tel.Span(ctx, "child", func(ctx context.Context) error {
+		child = trace.SpanContextFromContext(ctx)
+		return nil
+	}, trace.WithAttributes(attribute.String("step", "parse")))
+	parent.End()
+
+	if err != nil {
+		t.Fatalf("Span() = %v, want nil", err)
+	}
+
+	ended := spans.GetSpans()
+	if len(ended) != 2 {
+		t.Fatalf("got %d spans, want 2", len(ended))
+	}
+	got := ended[0]
+	if got.Name != "child" {
+		t.Fatalf("first ended span = %q, want child", got.Name)
+	}
+	if got.SpanContext.SpanID() != child.SpanID() {
+		t.Error("fn did not run with the child span in its context")
+	}
+	if got.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("child span is not parented to the span in ctx")
+	}
+	if got.Status.Code != codes.Unset {
+		t.Errorf("status = %v, want Unset", got.Status.Code)
+	}
+	if len(got.Attributes) != 1 || got.Attributes[0] != attribute.String("step", "parse") {
+		t.Errorf("attributes = %v, want step=parse", got.Attributes)
+	}
+}
+
+func TestSpanError(t *testing.T) {
+	tel, spans := NewForTesting()
+
+	want := errors.New("parse failed")
+	err := tel.Span(context.Background(), "parse", func(ctx context.Context) error {
+		return want
+	})
+	if err != want {
+		t.Fatalf("Span() = %v, want %v", err, want)
+	}
+
+	got := spans.GetSpans()[0]
+	if got.Status.Code != codes.Error || got.Status.Description != want.Error() {
+		t.Errorf("status = %+v, want Error %q", got.Status, want)
+	}
+	if len(got.Events) != 1 || got.Events[0].Name != "exception" {
+		t.Errorf("events = %v, want the recorded error", got.Events)
+	}
+}
+
+func TestSpanNilTelemetry(t *testing.T) {
+	var tel *Telemetry
+	ran := false
+	err := tel.Span(context.Background(), "noop", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ran {
+		t.Errorf("Span() on nil Telemetry = %v, ran = %t; want nil, true", err, ran)
+	}
+}
+
+func TestMetricPrefix(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.MetricPrefix = "challengeapp_"
+	tel, err := New(ctx, WithConfig(cfg), WithTracerExporter(tracetest.NewInMemoryExporter()), WithMetricReader(sdkmetric.NewManualReader()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tel.Shutdown(ctx)
+
+	tel.RecordRequest(ctx, "GET", "/", 200, 0)
+
+	snap, err := tel.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["challengeapp_http_requests_total"]; got != 1 {
+		t.Errorf("challengeapp_http_requests_total = %v, want 1", got)
+	}
+	if _, ok := snap.Values["http_requests_total"]; ok {
+		t.Error("unprefixed http_requests_total recorded")
+	}
+}
+
+func TestRecordAfterCancel(t *testing.T) {
+	tel, _ := NewForTesting()
+	defer tel.Shutdown(context.Background())
+
+	// Recording happens as the request finishes, often after the client has
+	// gone away; a canceled context must not drop the measurement
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tel.RecordMessageLength(ctx, 5)
+	tel.RecordTemplateTimeout(ctx, "echo.html")
+	tel.RecordRejectedHost(ctx, "evil.example")
+	tel.RecordDuplicateRequest(ctx, "POST", "idempotency_key")
+	tel.RecordBackpressure(ctx, "overloaded")
+
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Histograms["echo_message_length"].Count; got != 1 {
+		t.Errorf("echo_message_length count = %d, want 1", got)
+	}
+	for _, name := range []string{
+		"template_render_timeouts_total",
+		"http_rejected_hosts_total",
+		"duplicate_requests_total",
+		"backpressure_total",
+	} {
+		if got := snap.Values[name]; got != 1 {
+			t.Errorf("%s = %v, want 1", name, got)
+		}
+	}
+}
+
+func TestMetricPrefixInvalid(t *testing.T) {
+	cfg := testConfig()
+	cfg.MetricPrefix = "challenge-app."
+	cfg.PrometheusEnabled = true
+
+	if _, err := New(context.Background(), WithConfig(cfg), WithTracerExporter(tracetest.NewInMemoryExporter())); err == nil {
+		t.Fatal("New() = nil error, want invalid prefix rejected")
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.PrometheusEnabled = true
+	tel, err := New(ctx, WithConfig(cfg), WithTracerExporter(tracetest.NewInMemoryExporter()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tel.Shutdown(ctx)
+
+	tel.RecordRequest(ctx, "GET", "/echo", 200, 0)
+
+	rec := httptest.NewRecorder()
+	tel.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `http_requests_total{`) || !strings.Contains(body, `http_route="/echo"`) {
+		t.Errorf("scrape does not include http_requests_total for /echo:\n%s", body)
+	}
+}
+
+func TestMetricsHandlerDisabled(t *testing.T) {
+	tel, _ := NewForTesting()
+	if h := tel.MetricsHandler(); h != nil {
+		t.Error("MetricsHandler() is set with Prometheus disabled")
+	}
+}
+
+func TestResourceFromEnv(t *testing.T) {
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.region=eu-west-1,service.name=from-env,environment=from-env")
+
+	tel, spans := NewForTesting()
+	_, span := tel.Tracer.Start(context.Background(), "request")
+	span.End()
+
+	got := make(map[attribute.Key]string)
+	for _, kv := range spans.GetSpans()[0].Resource.Attributes() {
+		got[kv.Key] = kv.Value.Emit()
+	}
+	want := map[attribute.Key]string{
+		"deployment.region": "eu-west-1",
+		"service.name":      "test",
+		"environment":       "test",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("resource %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestNewConfigDurations(t *testing.T) {
+	t.Setenv("OTEL_BSP_SCHEDULE_DELAY", "2500")
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "30s")
+	t.Setenv("CANARY_INTERVAL", "60")
+	t.Setenv("OTEL_INIT_MAX_ELAPSED", "")
+
+	cfg, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	if cfg.BatchTimeout != 2500*time.Millisecond {
+		t.Errorf("BatchTimeout = %s, want 2.5s", cfg.BatchTimeout)
+	}
+	if cfg.MetricExportInterval != 30*time.Second {
+		t.Errorf("MetricExportInterval = %s, want 30s", cfg.MetricExportInterval)
+	}
+	// Not an OTEL_* variable, so "60" is invalid rather than 60ms
+	if cfg.CanaryInterval != time.Minute {
+		t.Errorf("CanaryInterval = %s, want the 1m default", cfg.CanaryInterval)
+	}
+	if cfg.InitMaxElapsed != 30*time.Second {
+		t.Errorf("InitMaxElapsed = %s, want the 30s default", cfg.InitMaxElapsed)
+	}
+}
+
+func TestForceFlushExportsPendingSpans(t *testing.T) {
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	tel, err := New(ctx,
+		WithConfig(testConfig()),
+		WithTracerExporter(exporter),
+		WithMetricReader(sdkmetric.NewManualReader()),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tel.Shutdown(ctx)
+
+	// A request finishing while the server shuts down
+	_, span := tel.Tracer.Start(ctx, "last-request")
+	span.End()
+	if got := exporter.GetSpans(); len(got) != 0 {
+		t.Fatalf("exported %d spans before flush, want 0 (still batched)", len(got))
+	}
+
+	if err := tel.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+	if got := exporter.GetSpans(); len(got) != 1 || got[0].Name != "last-request" {
+		t.Fatalf("exported spans = %v, want the last-request span", got)
+	}
+
+	// Flushing leaves the provider running
+	_, span = tel.Tracer.Start(ctx, "after-flush")
+	span.End()
+	if err := tel.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+	if got := exporter.GetSpans(); len(got) != 2 {
+		t.Errorf("exported %d spans, want 2", len(got))
+	}
+}
+
+func TestHistogramExemplarCarriesTraceID(t *testing.T) {
+	// The SDK only records exemplars behind its experimental flag, which the
+	// process environment has to provide
+	t.Setenv("OTEL_GO_X_EXEMPLAR", "true")
+
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.Exemplars = true
+	reader := sdkmetric.NewManualReader()
+	tel, err := New(ctx, WithConfig(cfg), WithTracerExporter(tracetest.NewInMemoryExporter()), WithMetricReader(reader))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tel.Shutdown(ctx)
+
+	spanCtx, span := tel.Tracer.Start(ctx, "request")
+	tel.RecordRequest(spanCtx, "GET", "/echo", 200, 10*time.Millisecond)
+	span.End()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	want := span.SpanContext().TraceID()
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "http_request_duration_seconds" {
+				continue
+			}
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok || len(hist.DataPoints) != 1 {
+				t.Fatalf("http_request_duration_seconds data = %#v, want one histogram point", m.Data)
+			}
+			exemplars := hist.DataPoints[0].Exemplars
+			if len(exemplars) == 0 {
+				t.Fatal("data point has no exemplars")
+			}
+			if !bytes.Equal(exemplars[0].TraceID, want[:]) {
+				t.Errorf("exemplar trace ID = %x, want %s", exemplars[0].TraceID, want)
+			}
+			return
+		}
+	}
+	t.Fatal("http_request_duration_seconds not collected")
+}
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := []struct {
+		raw        string
+		want       string
+		wantScheme string
+		wantErr    bool
+	}{
+		{"", "localhost:4318", "", false},
+		{"http://host:4318", "host:4318", "http", false},
+		{"http://host:4318/", "host:4318", "http", false},
+		{"https://host", "host:443", "https", false},
+		{"http://host", "host:80", "http", false},
+		{"host:4317", "host:4317", "", false},
+		{"host", "host:4318", "", false},
+		{"[::1]", "[::1]:4318", "", false},
+		{"ftp://host:21", "", "", true},
+		{"http://host:4318/v1/traces", "", "", true},
+		{"host:notaport", "", "", true},
+		{"host:70000", "", "", true},
+		{":4318", "", "", true},
+	}
+
+	for _, tt := range tests {
+		got, scheme, err := normalizeEndpoint(tt.raw, "4318")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeEndpoint(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want || scheme != tt.wantScheme {
+			t.Errorf("normalizeEndpoint(%q) = %q, %q, want %q, %q", tt.raw, got, scheme, tt.want, tt.wantScheme)
+		}
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		ctx := context.Background()
+		cfg := testConfig()
+		cfg.RuntimeMetrics = enabled
+		reader := sdkmetric.NewManualReader()
+		tel, err := New(ctx, WithConfig(cfg), WithTracerExporter(tracetest.NewInMemoryExporter()), WithMetricReader(reader))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		defer tel.Shutdown(ctx)
+
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(ctx, &rm); err != nil {
+			t.Fatalf("Collect: %v", err)
+		}
+
+		var goroutines int64
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != "process.runtime.go.goroutines" {
+					continue
+				}
+				// Reported as a gauge-like, non-monotonic sum
+				gauge, ok := m.Data.(metricdata.Sum[int64])
+				if !ok || gauge.IsMonotonic || len(gauge.DataPoints) != 1 {
+					t.Fatalf("goroutines data = %#v, want one non-monotonic point", m.Data)
+				}
+				goroutines = gauge.DataPoints[0].Value
+			}
+		}
+		if enabled && goroutines <= 0 {
+			t.Errorf("RuntimeMetrics=true: goroutines = %d, want > 0", goroutines)
+		}
+		if !enabled && goroutines != 0 {
+			t.Errorf("RuntimeMetrics=false: goroutines reported (%d)", goroutines)
+		}
+	}
+}
+
+func TestHistogramViewBoundaries(t *testing.T) {
+	t.Setenv("HTTP_DURATION_BUCKETS", "0.1, 0.5, 1")
+	cfg, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	ctx := context.Background()
+	// Views name the instrument without the prefix
+	cfg.MetricPrefix = "app_"
+	reader := sdkmetric.NewManualReader()
+	tel, err := New(ctx, WithConfig(cfg), WithTracerExporter(tracetest.NewInMemoryExporter()), WithMetricReader(reader))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tel.Shutdown(ctx)
+
+	tel.RecordRequest(ctx, "GET", "/echo", 200, 300*time.Millisecond)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "app_http_request_duration_seconds" {
+				continue
+			}
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok || len(hist.DataPoints) != 1 {
+				t.Fatalf("app_http_request_duration_seconds data = %#v, want one histogram point", m.Data)
+			}
+			dp := hist.DataPoints[0]
+			if want := []float64{0.1, 0.5, 1}; !reflect.DeepEqual(dp.Bounds, want) {
+				t.Errorf("bounds = %v, want %v", dp.Bounds, want)
+			}
+			if want := []uint64{0, 1, 0, 0}; !reflect.DeepEqual(dp.BucketCounts, want) {
+				t.Errorf("bucket counts = %v, want %v", dp.BucketCounts, want)
+			}
+			return
+		}
+	}
+	t.Fatal("app_http_request_duration_seconds not collected")
+}
+
+func TestNewConfigInvalidBuckets(t *testing.T) {
+	for _, v := range []string{"0.5,0.1", "0.1,fast"} {
+		t.Setenv("HTTP_DURATION_BUCKETS", v)
+		if _, err := NewConfig(); err == nil {
+			t.Errorf("NewConfig with HTTP_DURATION_BUCKETS=%q succeeded, want error", v)
+		}
+	}
+}
+
+func TestNewConfigMetricsExporter(t *testing.T) {
+	tests := []struct {
+		value            string
+		push, prometheus bool
+	}{
+		{"otlp", true, false},
+		{"prometheus", false, true},
+		{"otlp, prometheus", true, true},
+		{"none", false, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_METRICS_EXPORTER", tt.value)
+		cfg, err := NewConfig()
+		if err != nil {
+			t.Fatalf("NewConfig with OTEL_METRICS_EXPORTER=%q: %v", tt.value, err)
+		}
+		if cfg.PushMetrics != tt.push || cfg.PrometheusEnabled != tt.prometheus {
+			t.Errorf("OTEL_METRICS_EXPORTER=%q: push = %v, prometheus = %v, want %v, %v",
+				tt.value, cfg.PushMetrics, cfg.PrometheusEnabled, tt.push, tt.prometheus)
+		}
+	}
+
+	for _, v := range []string{"console", "otlp,prometeus"} {
+		t.Setenv("OTEL_METRICS_EXPORTER", v)
+		if _, err := NewConfig(); err == nil {
+			t.Errorf("NewConfig with OTEL_METRICS_EXPORTER=%q succeeded, want error", v)
+		}
+	}
+}
+
+// collectHistogram returns the data points of the named float64 histogram
+func collectHistogram(t *testing.T, reader sdkmetric.Reader, name string) []metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok {
+				t.Fatalf("%s data = %T, want a float64 histogram", name, m.Data)
+			}
+			return hist.DataPoints
+		}
+	}
+	return nil
+}
+
+func TestRouteDurationBuckets(t *testing.T) {
+	t.Setenv("HTTP_ROUTE_DURATION_BUCKETS", "/echo=0.0001,0.0005,0.001; /upload=1,5,10")
+	cfg, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	tel, err := New(ctx, WithConfig(cfg), WithTracerExporter(tracetest.NewInMemoryExporter()), WithMetricReader(reader))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tel.Shutdown(ctx)
+
+	tel.RecordRequest(ctx, "POST", "/echo", 200, 300*time.Microsecond)
+	tel.RecordRequest(ctx, "GET", "/", 200, 300*time.Microsecond)
+
+	echo := collectHistogram(t, reader, "http_request_duration_echo_seconds")
+	if len(echo) != 1 {
+		t.Fatalf("got %d /echo points, want 1 (other routes must not be recorded)", len(echo))
+	}
+	if want := []float64{0.0001, 0.0005, 0.001}; !reflect.DeepEqual(echo[0].Bounds, want) {
+		t.Errorf("/echo bounds = %v, want %v", echo[0].Bounds, want)
+	}
+	if want := []uint64{0, 1, 0, 0}; !reflect.DeepEqual(echo[0].BucketCounts, want) {
+		t.Errorf("/echo bucket counts = %v, want %v", echo[0].BucketCounts, want)
+	}
+
+	// The shared histogram keeps its default layout for every route
+	all := collectHistogram(t, reader, "http_request_duration_seconds")
+	if len(all) != 2 {
+		t.Fatalf("got %d http_request_duration_seconds points, want 2", len(all))
+	}
+	for _, dp := range all {
+		if len(dp.Bounds) != 12 || dp.Bounds[0] != 0.001 {
+			t.Errorf("default bounds = %v, want the 12 default buckets", dp.Bounds)
+		}
+	}
+}
+
+func TestParseRouteBuckets(t *testing.T) {
+	got, err := parseRouteBuckets("/echo=0.1,0.5;/upload=1,5;")
+	if err != nil {
+		t.Fatalf("parseRouteBuckets: %v", err)
+	}
+	want := map[string][]float64{"/echo": {0.1, 0.5}, "/upload": {1, 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRouteBuckets = %v, want %v", got, want)
+	}
+
+	for _, v := range []string{"/echo", "=0.1", "/echo=0.5,0.1"} {
+		if _, err := parseRouteBuckets(v); err == nil {
+			t.Errorf("parseRouteBuckets(%q) = nil error, want error", v)
+		}
+	}
+}
+
+func TestRouteDurationInstrument(t *testing.T) {
+	tests := map[string]string{
+		"/echo":          "http_request_duration_echo_seconds",
+		"/":              "http_request_duration_root_seconds",
+		"/debug/status/": "http_request_duration_debug_status_seconds",
+		"/Users/{id}":    "http_request_duration_users__id_seconds",
+	}
+	for route, want := range tests {
+		if got := routeDurationInstrument(route); got != want {
+			t.Errorf("routeDurationInstrument(%q) = %q, want %q", route, got, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// NewForTesting creates a Telemetry through New, with the production sampler
+// and propagators, backed by an in-memory span exporter and a manual metric
+// reader instead of the network. Spans are exported synchronously to the
+// returned exporter and metrics can be read back with Snapshot. Like New, it
+// installs the global providers and propagator.
+func NewForTesting() (*Telemetry, *tracetest.InMemoryExporter) {
+	cfg := &Config{
+		ServiceName:    "test",
+		ServiceVersion: "test",
+		Environment:    "test",
+		Exporter:       ExporterOTLP,
+		Protocol:       ProtocolHTTPProtobuf,
+		ExposeTraceID:  true,
+		Exemplars:      true,
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	tel, err := New(context.Background(),
+		WithConfig(cfg),
+		WithTracerExporter(exporter),
+		WithMetricReader(sdkmetric.NewManualReader()),
+		func(o *options) { o.syncExport = true },
+	)
+	if err != nil {
+		panic(fmt.Sprintf("telemetry: NewForTesting: %v", err))
+	}
+
+	return tel, exporter
+}
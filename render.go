@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errTemplateTimeout is returned when a render exceeds templateTimeout
+var errTemplateTimeout = errors.New("template execution timed out")
+
+// templateTimeout bounds how long a single template execution may run
+var templateTimeout = 5 * time.Second
+
+// homeData is the data model rendered by index.html
+type homeData struct {
+	RequestsServed int64
+}
+
+// echoData is the data model rendered by echo.html
+type echoData struct {
+	Message string
+}
+
+// templateSamples maps each template to a representative zero value of the
+// data it is rendered with, used to validate templates at startup
+var templateSamples = map[string]interface{}{
+	"index.html":     homeData{},
+	"echo.html":      echoData{},
+	"echo-dark.html": echoData{},
+}
+
+// defaultEchoTemplate is rendered when no valid theme is selected
+const defaultEchoTemplate = "echo.html"
+
+// echoTemplates maps the selectable themes to their echo templates
+var echoTemplates = map[string]string{
+	"default": defaultEchoTemplate,
+	"dark":    "echo-dark.html",
+}
+
+// selectEchoTemplate picks the echo template from the "theme" query parameter,
+// falling back to the "theme" cookie. Unknown themes use the default template.
+func selectEchoTemplate(r *http.Request) string {
+	theme := r.URL.Query().Get("theme")
+	if theme == "" {
+		if c, err := r.Cookie("theme"); err == nil {
+			theme = c.Value
+		}
+	}
+
+	if name, ok := echoTemplates[theme]; ok {
+		return name
+	}
+	return defaultEchoTemplate
+}
+
+// validateTemplates executes every parsed template once against its sample
+// data so template/data-model mismatches surface at boot rather than on the
+// first user request
+func validateTemplates() error {
+	var errs []error
+	for _, t := range templates.Templates() {
+		if err := t.Execute(io.Discard, templateSamples[t.Name()]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// renderTemplate executes the named template into a buffer and only writes it
+// to w once rendering succeeds. html/template is not context-aware, so the
+// render runs in its own goroutine and is abandoned if it exceeds
+// templateTimeout (errTemplateTimeout) or the request is canceled (ctx.Err());
+// the goroutine finishes in the background and its output is discarded. For HEAD requests only the headers, including Content-Length,
+// are sent.
+func renderTemplate(ctx context.Context, w http.ResponseWriter, r *http.Request, name string, data interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, templateTimeout)
+	defer cancel()
+
+	type result struct {
+		buf bytes.Buffer
+		err error
+	}
+	done := make(chan *result, 1)
+
+	go func() {
+		res := &result{}
+		res.err = templates.ExecuteTemplate(&res.buf, name, data)
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return res.err
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writeBody(w, r, http.StatusOK, res.buf.Bytes())
+		return nil
+	case <-ctx.Done():
+		// The request context is canceled too when the client goes away,
+		// which says nothing about how long the render took
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return errTemplateTimeout
+		}
+		return ctx.Err()
+	}
+}
+
+// writeBody writes a fully buffered response with an exact Content-Length,
+// skipping the body itself for HEAD requests
+func writeBody(w http.ResponseWriter, r *http.Request, statusCode int, body []byte) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(statusCode)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// writeRenderError records a failed render on the span and writes the error
+// response: 503 when the render budget was exceeded, 500 otherwise. A render
+// abandoned because the client disconnected is only logged, since nobody is
+// left to read a response.
+func writeRenderError(ctx context.Context, w http.ResponseWriter, name string, err error) {
+	if errors.Is(err, context.Canceled) {
+		middleware.LoggerFromContext(ctx).InfoContext(ctx, "template render abandoned, client disconnected",
+			"template", name,
+		)
+		return
+	}
+
+	timedOut := errors.Is(err, errTemplateTimeout)
+
+	middleware.LoggerFromContext(ctx).ErrorContext(ctx, "template render failed",
+		"template", name,
+		"error", err.Error(),
+		"timed_out", timedOut,
+	)
+
+	if tel != nil {
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		if timedOut {
+			span.SetStatus(codes.Error, "template execution timed out")
+			span.SetAttributes(attribute.String("error.type", "template_timeout"))
+			tel.RecordTemplateTimeout(ctx, name)
+		} else {
+			span.SetStatus(codes.Error, "template execution failed")
+		}
+	}
+
+	if timedOut {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
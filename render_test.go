@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/telemetry"
+)
+
+// useTemplates swaps the global templates for the duration of the test
+func useTemplates(t *testing.T, tmpl *template.Template) {
+	t.Helper()
+	orig := templates
+	templates = tmpl
+	t.Cleanup(func() { templates = orig })
+}
+
+func TestValidateTemplates(t *testing.T) {
+	if err := validateTemplates(); err != nil {
+		t.Fatalf("validateTemplates() = %v, want nil for the shipped templates", err)
+	}
+}
+
+func TestValidateTemplatesBroken(t *testing.T) {
+	tmpl := template.Must(template.New("index.html").Parse(`{{.RequestsServed}}`))
+	template.Must(tmpl.New("echo.html").Parse(`{{.Msg}}`))
+	useTemplates(t, tmpl)
+
+	err := validateTemplates()
+	if err == nil {
+		t.Fatal("validateTemplates() = nil, want an error for a missing field")
+	}
+	if !strings.Contains(err.Error(), "echo.html") {
+		t.Errorf("error %q does not name echo.html", err)
+	}
+	if strings.Contains(err.Error(), "index.html") {
+		t.Errorf("error %q names the valid index.html", err)
+	}
+}
+
+func TestSelectEchoTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		want   string
+	}{
+		{"default", "", "", "echo.html"},
+		{"query", "?theme=dark", "", "echo-dark.html"},
+		{"cookie", "", "dark", "echo-dark.html"},
+		{"query wins over cookie", "?theme=default", "dark", "echo.html"},
+		{"unknown theme", "?theme=neon", "", "echo.html"},
+		{"unknown cookie", "", "neon", "echo.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/echo"+tt.query, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "theme", Value: tt.cookie})
+			}
+			if got := selectEchoTemplate(r); got != tt.want {
+				t.Errorf("selectEchoTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// slowTemplates returns templates whose echo.html takes delay to render
+func slowTemplates(delay time.Duration) *template.Template {
+	return template.Must(template.New("echo.html").Funcs(template.FuncMap{
+		"slow": func() string {
+			time.Sleep(delay)
+			return "done"
+		},
+	}).Parse(`{{slow}}`))
+}
+
+// useTelemetry swaps in test telemetry for the duration of the test
+func useTelemetry(t *testing.T) *telemetry.Telemetry {
+	t.Helper()
+	orig := tel
+	tel, _ = telemetry.NewForTesting()
+	t.Cleanup(func() { tel = orig })
+	return tel
+}
+
+// useTemplateTimeout sets the render budget for the duration of the test
+func useTemplateTimeout(t *testing.T, d time.Duration) {
+	t.Helper()
+	orig := templateTimeout
+	templateTimeout = d
+	t.Cleanup(func() { templateTimeout = orig })
+}
+
+func TestRenderTemplateTimeout(t *testing.T) {
+	useTemplates(t, slowTemplates(200*time.Millisecond))
+	useTemplateTimeout(t, 20*time.Millisecond)
+	tel := useTelemetry(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	err := renderTemplate(r.Context(), rec, r, "echo.html", nil)
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("renderTemplate took %s, want it abandoned after ~20ms", elapsed)
+	}
+	if !errors.Is(err, errTemplateTimeout) {
+		t.Fatalf("renderTemplate() = %v, want errTemplateTimeout", err)
+	}
+
+	writeRenderError(r.Context(), rec, "echo.html", err)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["template_render_timeouts_total"]; got != 1 {
+		t.Errorf("template_render_timeouts_total = %v, want 1", got)
+	}
+}
+
+func TestRenderTemplateClientDisconnect(t *testing.T) {
+	useTemplates(t, slowTemplates(200*time.Millisecond))
+	useTemplateTimeout(t, time.Second)
+	tel := useTelemetry(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/echo", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err := renderTemplate(ctx, rec, r, "echo.html", nil)
+	if errors.Is(err, errTemplateTimeout) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("renderTemplate() = %v, want context.Canceled", err)
+	}
+
+	writeRenderError(ctx, rec, "echo.html", err)
+	if rec.Body.Len() != 0 {
+		t.Errorf("wrote %q to a disconnected client, want nothing", rec.Body.String())
+	}
+	snap, err := tel.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if got := snap.Values["template_render_timeouts_total"]; got != 0 {
+		t.Errorf("template_render_timeouts_total = %v, want 0", got)
+	}
+}
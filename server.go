@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gabrielsilvao/challenge1-app/pkg/env"
+)
+
+// Default server timeouts, overridable via SERVER_*_TIMEOUT
+const (
+	defaultReadTimeout  = 15 * time.Second
+	defaultWriteTimeout = 15 * time.Second
+	defaultIdleTimeout  = 60 * time.Second
+	// defaultReadHeaderTimeout of zero makes net/http use the read timeout
+	defaultReadHeaderTimeout = 0
+)
+
+// newServer builds the HTTP server for addr with timeouts from the
+// environment. Unlike other settings, an invalid timeout is an error rather
+// than a warning, since silently serving with the wrong limits is worse than
+// refusing to start.
+func newServer(addr string, handler http.Handler) (*http.Server, error) {
+	readTimeout, err := env.Duration("SERVER_READ_TIMEOUT", defaultReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+	writeTimeout, err := env.Duration("SERVER_WRITE_TIMEOUT", defaultWriteTimeout)
+	if err != nil {
+		return nil, err
+	}
+	idleTimeout, err := env.Duration("SERVER_IDLE_TIMEOUT", defaultIdleTimeout)
+	if err != nil {
+		return nil, err
+	}
+	readHeaderTimeout, err := env.Duration("SERVER_READ_HEADER_TIMEOUT", defaultReadHeaderTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}, nil
+}
+
+// tlsFilesFromEnv returns the key pair configured by TLS_CERT_FILE and
+// TLS_KEY_FILE, or empty names to serve plaintext. Setting only one of them
+// is an error: a partial config is a deployment mistake, not a request for
+// plaintext.
+func tlsFilesFromEnv() (certFile, keyFile string, err error) {
+	certFile, keyFile = os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		return "", "", fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together (cert: %q, key: %q)", certFile, keyFile)
+	}
+	return certFile, keyFile, nil
+}
+
+// serve accepts connections on ln until the server is shut down, over TLS
+// 1.2 or later when certFile and keyFile are set
+func serve(server *http.Server, ln net.Listener, certFile, keyFile string) error {
+	if certFile == "" {
+		return server.Serve(ln)
+	}
+	server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return server.ServeTLS(ln, certFile, keyFile)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key to dir,
+// returning the file names and the certificate for clients to trust
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, cert := writeSelfSignedCert(t, t.TempDir())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil {
+				t.Error("request was not served over TLS")
+			}
+		}),
+		// The refused TLS 1.1 handshake below is logged otherwise
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	done := make(chan error, 1)
+	go func() { done <- serve(server, ln, certFile, keyFile) }()
+	defer func() {
+		server.Close()
+		if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("serve = %v, want http.ErrServerClosed", err)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	resp, err := client.Get("https://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("HTTPS request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("negotiated %+v, want TLS 1.2 or later", resp.TLS)
+	}
+
+	// Clients capped below TLS 1.2 are refused
+	old := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: tls.VersionTLS11}}}
+	if resp, err := old.Get("https://" + ln.Addr().String() + "/"); err == nil {
+		resp.Body.Close()
+		t.Error("TLS 1.1 request succeeded, want handshake failure")
+	}
+}
+
+func TestTLSFilesFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		cert    string
+		key     string
+		wantErr bool
+	}{
+		{"plaintext", "", "", false},
+		{"both set", "cert.pem", "key.pem", false},
+		{"cert only", "cert.pem", "", true},
+		{"key only", "", "key.pem", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TLS_CERT_FILE", tt.cert)
+			t.Setenv("TLS_KEY_FILE", tt.key)
+
+			certFile, keyFile, err := tlsFilesFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tlsFilesFromEnv() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && (certFile != tt.cert || keyFile != tt.key) {
+				t.Errorf("tlsFilesFromEnv() = %q, %q, want %q, %q", certFile, keyFile, tt.cert, tt.key)
+			}
+		})
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	t.Setenv("SERVER_READ_TIMEOUT", "5s")
+	t.Setenv("SERVER_WRITE_TIMEOUT", "")
+	t.Setenv("SERVER_IDLE_TIMEOUT", "2m")
+	t.Setenv("SERVER_READ_HEADER_TIMEOUT", "")
+
+	server, err := newServer(":8080", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+
+	if server.Addr != ":8080" {
+		t.Errorf("Addr = %q, want %q", server.Addr, ":8080")
+	}
+	tests := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"ReadTimeout", server.ReadTimeout, 5 * time.Second},
+		{"WriteTimeout", server.WriteTimeout, defaultWriteTimeout},
+		{"IdleTimeout", server.IdleTimeout, 2 * time.Minute},
+		{"ReadHeaderTimeout", server.ReadHeaderTimeout, defaultReadHeaderTimeout},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestNewServerInvalidTimeout(t *testing.T) {
+	for _, key := range []string{"SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SERVER_IDLE_TIMEOUT", "SERVER_READ_HEADER_TIMEOUT"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, "soon")
+			if _, err := newServer(":8080", http.NotFoundHandler()); err == nil {
+				t.Errorf("newServer with %s=soon succeeded, want error", key)
+			}
+		})
+	}
+}